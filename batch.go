@@ -0,0 +1,178 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+)
+
+const (
+	// Maximum batch size for Standard tier namespaces.
+	StandardMaxBatchSize = 256 * 1024
+
+	// Maximum batch size for Premium tier namespaces.
+	PremiumMaxBatchSize = 1024 * 1024
+)
+
+const contentTypeBatch = "application/vnd.microsoft.servicebus.json"
+
+// Entry of the Service Bus batch format.
+//
+// See https://docs.microsoft.com/en-us/rest/api/servicebus/send-message-batch
+type batchEntry struct {
+	Body             string                     `json:"Body"`
+	BrokerProperties *brokerProperties          `json:"BrokerProperties,omitempty"`
+	UserProperties   map[string]json.RawMessage `json:"UserProperties,omitempty"`
+}
+
+// Sends messages to a Service Bus queue using as few batch requests as possible.
+// Messages are split into several batches when they don't fit into MaxBatchSize.
+// Every message is encoded before anything is sent, so a message that doesn't fit
+// into a batch on its own, whose body isn't valid UTF-8 or that has a ContentType, fails the whole call
+// without sending any message.
+// The batch format has no content type, so messages created with NewMessageWithCodec must be sent with SendMessage.
+// If a batch fails, a SendBatchError reports how many messages the batches before it sent.
+//
+// For more information see https://docs.microsoft.com/en-us/rest/api/servicebus/send-message-batch
+func (q *QueueClient) SendBatch(msgs []*Message) error {
+	return q.SendBatchContext(context.Background(), msgs)
+}
+
+// SendBatchContext is like SendBatch but uses ctx for the requests.
+// If ctx is done before all batches are sent, the SendBatchError wraps ctx.Err().
+func (q *QueueClient) SendBatchContext(ctx context.Context, msgs []*Message) error {
+
+	batches, counts, err := splitBatches(msgs, q.maxBatchSize())
+
+	if err != nil {
+		return err
+	}
+
+	// without a MessageId duplicate detection can't discard the messages of a failed attempt
+	idempotent := true
+	for _, msg := range msgs {
+		idempotent = idempotent && msg.Id != ""
+	}
+
+	sent := 0
+	for i, batch := range batches {
+		if err := q.sendBatch(ctx, batch, idempotent); err != nil {
+			return SendBatchError{sent, err}
+		}
+		sent += counts[i]
+	}
+
+	return nil
+}
+
+func (q *QueueClient) sendBatch(ctx context.Context, batch []byte, idempotent bool) error {
+	resp, err := q.do(ctx, "SendBatch", idempotent, func() (*http.Request, error) {
+		req, err := q.createRequestWithBody(ctx, "messages/", "POST", bytes.NewReader(batch))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set(headerContentType, contentTypeBatch)
+		return req, nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+func (q *QueueClient) maxBatchSize() int {
+	if q.MaxBatchSize <= 0 {
+		return StandardMaxBatchSize
+	}
+
+	if q.MaxBatchSize > PremiumMaxBatchSize {
+		return PremiumMaxBatchSize
+	}
+
+	return q.MaxBatchSize
+}
+
+// Encodes messages into JSON arrays of the batch format no larger than maxSize bytes each,
+// and returns the number of messages in each of them.
+func splitBatches(msgs []*Message, maxSize int) ([][]byte, []int, error) {
+
+	var batches [][]byte
+	var counts []int
+	var batch []byte
+	count := 0
+
+	for i, msg := range msgs {
+		entry, err := encodeBatchEntry(msg)
+
+		if err != nil {
+			return nil, nil, wrap(err, fmt.Sprintf("Message %d encode failed", i))
+		}
+
+		// an entry needs room for the enclosing brackets
+		if len(entry)+2 > maxSize {
+			return nil, nil, fmt.Errorf("Message %d is %d bytes and exceeds the batch size limit of %d bytes", i, len(entry), maxSize)
+		}
+
+		// an entry is separated from the previous one by a comma
+		if batch != nil && len(batch)+1+len(entry)+1 > maxSize {
+			batches = append(batches, append(batch, ']'))
+			counts = append(counts, count)
+			batch, count = nil, 0
+		}
+
+		if batch == nil {
+			batch = append([]byte{'['}, entry...)
+		} else {
+			batch = append(append(batch, ','), entry...)
+		}
+		count++
+	}
+
+	if batch != nil {
+		batches = append(batches, append(batch, ']'))
+		counts = append(counts, count)
+	}
+
+	return batches, counts, nil
+}
+
+func encodeBatchEntry(msg *Message) ([]byte, error) {
+	// the batch format carries the body as a JSON string, which can't hold binary data
+	if !utf8.Valid(msg.Body) {
+		return nil, fmt.Errorf("Body isn't valid UTF-8, binary bodies can't be sent in a batch")
+	}
+
+	// the content type would be lost, and Decode fail on the received message
+	if msg.ContentType != "" {
+		return nil, fmt.Errorf("ContentType %s can't be sent in a batch", msg.ContentType)
+	}
+
+	b := brokerProperties{}
+	b.CopyFromMessage(msg)
+
+	// encoded like property headers, so that dates and floats are received with their type
+	encoded, err := encodeProperties(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var properties map[string]json.RawMessage
+	for k, v := range encoded {
+		if properties == nil {
+			properties = map[string]json.RawMessage{}
+		}
+		properties[k] = json.RawMessage(v)
+	}
+
+	return json.Marshal(batchEntry{
+		Body:             string(msg.Body),
+		BrokerProperties: &b,
+		UserProperties:   properties,
+	})
+}
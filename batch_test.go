@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func Test_splitBatches(t *testing.T) {
+
+	var msgs []*Message
+	for i := 0; i < 10; i++ {
+		msg := NewMessage(bytes.Repeat([]byte("a"), 100))
+		msg.Properties.Set("Prop1", "Value1")
+		msgs = append(msgs, msg)
+	}
+
+	entry, _ := encodeBatchEntry(msgs[0])
+	maxSize := 3*len(entry) + 4
+
+	batches, counts, err := splitBatches(msgs, maxSize)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batches) != 4 {
+		t.Fatalf("Expected 4 batches but got %d", len(batches))
+	}
+
+	count := 0
+	for i, batch := range batches {
+		if len(batch) > maxSize {
+			t.Fatalf("Expected batch size at most %d but got %d", maxSize, len(batch))
+		}
+
+		var entries []batchEntry
+		if err := json.Unmarshal(batch, &entries); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, e := range entries {
+			if string(e.UserProperties["Prop1"]) != `"Value1"` {
+				t.Fatalf("Expected property Prop1 value \"Value1\" but got %s", e.UserProperties["Prop1"])
+			}
+		}
+
+		if len(entries) != counts[i] {
+			t.Fatalf("Expected %d messages in batch %d but got %d", counts[i], i, len(entries))
+		}
+
+		count += len(entries)
+	}
+
+	if count != len(msgs) {
+		t.Fatalf("Expected %d messages but got %d", len(msgs), count)
+	}
+}
+
+func Test_splitBatches_tooLarge(t *testing.T) {
+
+	msgs := []*Message{
+		NewMessage([]byte("small")),
+		NewMessage(bytes.Repeat([]byte("a"), StandardMaxBatchSize)),
+	}
+
+	if _, _, err := splitBatches(msgs, StandardMaxBatchSize); err == nil {
+		t.Fatal("Expected message size error but got nil")
+	}
+}
+
+func Test_SendBatch(t *testing.T) {
+
+	var bodies []string
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		if ct := req.Header.Get(headerContentType); ct != contentTypeBatch {
+			t.Fatalf("Expected Content-Type %s but got %s", contentTypeBatch, ct)
+		}
+
+		body, _ := ioutil.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+
+		return &http.Response{StatusCode: http.StatusCreated, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	msg := NewMessage([]byte("Hello!"))
+	msg.Id = "1"
+	msg.Label = "label"
+
+	if err := q.SendBatch([]*Message{msg, msg}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bodies) != 1 {
+		t.Fatalf("Expected 1 request but got %d", len(bodies))
+	}
+
+	expected := `[{"Body":"Hello!","BrokerProperties":{"MessageId":"1","Label":"label"}},{"Body":"Hello!","BrokerProperties":{"MessageId":"1","Label":"label"}}]`
+	if bodies[0] != expected {
+		t.Fatalf("Expected body %s but got %s", expected, bodies[0])
+	}
+}
+
+func Test_splitBatches_binaryBody(t *testing.T) {
+
+	msgs := []*Message{
+		NewMessage([]byte("text")),
+		NewMessage([]byte{0xff, 0xfe, 0x00}),
+	}
+
+	if _, _, err := splitBatches(msgs, StandardMaxBatchSize); err == nil || !strings.Contains(err.Error(), "Message 1") {
+		t.Fatalf("Expected UTF-8 error for message 1 but got %v", err)
+	}
+}
+
+func Test_splitBatches_contentType(t *testing.T) {
+
+	msg, err := NewMessageWithCodec(JSONCodec{}, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := []*Message{NewMessage([]byte("text")), msg}
+
+	if _, _, err := splitBatches(msgs, StandardMaxBatchSize); err == nil || !strings.Contains(err.Error(), "Message 1") {
+		t.Fatalf("Expected ContentType error for message 1 but got %v", err)
+	}
+}
+
+func Test_SendBatch_partialFailure(t *testing.T) {
+
+	requests := 0
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		if requests == 2 {
+			return &http.Response{StatusCode: http.StatusInternalServerError, Body: ioutil.NopCloser(strings.NewReader("failed"))}, nil
+		}
+
+		return &http.Response{StatusCode: http.StatusCreated, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	var msgs []*Message
+	for i := 0; i < 6; i++ {
+		msgs = append(msgs, NewMessage(bytes.Repeat([]byte("a"), 100)))
+	}
+
+	entry, _ := encodeBatchEntry(msgs[0])
+	cli := QueueClient{Namespace: "test", QueueName: "test", MaxBatchSize: 2*len(entry) + 3}
+
+	var batchErr SendBatchError
+	err := cli.SendBatch(msgs)
+
+	if !errors.As(err, &batchErr) || batchErr.Sent != 2 {
+		t.Fatalf("Expected %T with 2 sent messages but got %v", SendBatchError{}, err)
+	}
+
+	if !errors.As(err, &InternalError{}) {
+		t.Fatalf("Expected %T but got %v", InternalError{}, err)
+	}
+}
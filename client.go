@@ -2,15 +2,12 @@ package queue
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
+	"context"
 	"encoding/json"
-	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/textproto"
-	"net/url"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,16 +20,28 @@ const (
 	headerBrokerProperties = "BrokerProperties"
 	headerContentType      = "Content-Type"
 	headerDate             = "Date"
+
+	headerDeadLetterReason           = "DeadLetterReason"
+	headerDeadLetterErrorDescription = "DeadLetterErrorDescription"
 )
 
 type HttpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-var httpClientOverride HttpClient = nil
+var (
+	httpClientMu       sync.RWMutex
+	httpClientOverride HttpClient = nil
+
+	// Shared by clients without an http client of their own, so that connections are reused.
+	defaultHttpClient HttpClient = &http.Client{}
+)
 
-// Sets the package's http client.
+// Sets the package's http client, used by clients created without WithHttpClient. Pass nil to reset it.
 func SetHttpClient(client HttpClient) {
+	httpClientMu.Lock()
+	defer httpClientMu.Unlock()
+
 	httpClientOverride = client
 }
 
@@ -78,16 +87,30 @@ type Message struct {
 	ReplyToSessionId        string
 	PartitionKey            string
 
+	// Set on messages received from a dead-letter queue.
+	DeadLetterReason           string
+	DeadLetterErrorDescription string
+
 	Properties Properties
 
+	// Properties with their type, see TypedProperties.
+	TypedProperties TypedProperties
+
 	Body []byte
+
+	// Lock expiry shared with the renewer started by AutoRenewLock.
+	renewed *lockExpiry
+
+	// Custom properties as received, formatted as strings, to tell the ones changed in Properties since.
+	receivedProperties map[string]string
 }
 
 func NewMessage(body []byte) *Message {
 
-	return &Message {
-		Body: body,
-		Properties: Properties{},
+	return &Message{
+		Body:            body,
+		Properties:      Properties{},
+		TypedProperties: TypedProperties{},
 	}
 }
 
@@ -105,11 +128,35 @@ type QueueClient struct {
 	// Name of the queue.
 	QueueName string
 
+	// Base URL of the namespace including scheme, host and port, used to target sovereign clouds,
+	// emulators or local stand-ins e.g. https://<yournamespace>.servicebus.chinacloudapi.cn:443 or http://localhost:8080.
+	// Defaults to https://<Namespace>.servicebus.windows.net:443.
+	Endpoint string
+
+	// Supplies the tokens authorizing requests, e.g. pre-issued SAS tokens or Azure AD bearer tokens.
+	// Defaults to signing a Shared Access Signature token with KeyName and KeyValue for every request.
+	TokenProvider TokenProvider
+
 	// Request timeout in seconds.
 	Timeout int
 
-	mu         sync.Mutex
+	// Lock duration configured on the queue. RenewLock uses it to update Message.LockedUntilUtc
+	// when the service doesn't report the new lock expiry.
+	LockDuration time.Duration
+
+	// Policy for retrying transient failures. Nil disables retries.
+	RetryPolicy *RetryPolicy
+
+	// Maximum size in bytes of a single SendBatch request.
+	// Defaults to StandardMaxBatchSize, use PremiumMaxBatchSize for Premium tier namespaces.
+	MaxBatchSize int
+
+	// Set by WithHttpClient and WithLogger.
 	httpClient HttpClient
+	logger     *internalLogger
+
+	// Path of a topic, subscription or sub-queue overriding QueueName.
+	entityPath string
 }
 
 // This operation atomically retrieves and locks a message from a queue or subscription for processing.
@@ -122,44 +169,73 @@ type QueueClient struct {
 
 // For more information see https://docs.microsoft.com/en-us/rest/api/servicebus/peek-lock-message-non-destructive-read
 func (q *QueueClient) GetMessage() (*Message, error) {
+	return q.GetMessageContext(context.Background())
+}
 
-	req, err := q.createRequest("messages/head?timeout="+strconv.Itoa(q.Timeout), "POST")
+// GetMessageContext is like GetMessage but uses ctx to cancel the long-poll or limit its duration.
+// If ctx is done before a message is received, ctx.Err() is returned.
+func (q *QueueClient) GetMessageContext(ctx context.Context) (*Message, error) {
 
-	if err != nil {
-		return nil, wrap(err, "Request create failed")
-	}
-	resp, err := q.getClient().Do(req)
+	// a retried receive at worst leaves a message locked until its lock expires
+	resp, err := q.do(ctx, "GetMessage", true, func() (*http.Request, error) {
+		return q.createRequest(ctx, "messages/head?timeout="+strconv.Itoa(q.Timeout), "POST")
+	})
 
 	if err != nil {
-		return nil, wrap(err, "Sending POST createRequest failed")
+		return nil, err
 	}
 
 	defer resp.Body.Close()
 
-	if err := handleStatusCode(resp); err != nil {
+	return q.parseMessage(resp)
+}
+
+// This operation receives a message from a queue or subscription, and removes the message from that queue
+// or subscription in one atomic operation.
+// If the message is lost in transit or the receiver fails to process it, the message is not delivered again,
+// so use it only where at-most-once delivery is acceptable.
+//
+// For more information see https://docs.microsoft.com/en-us/rest/api/servicebus/receive-and-delete-message-destructive-read
+func (q *QueueClient) ReceiveAndDelete() (*Message, error) {
+	return q.ReceiveAndDeleteContext(context.Background())
+}
+
+// ReceiveAndDeleteContext is like ReceiveAndDelete but uses ctx to cancel the long-poll or limit its duration.
+// If ctx is done before a message is received, ctx.Err() is returned.
+func (q *QueueClient) ReceiveAndDeleteContext(ctx context.Context) (*Message, error) {
+
+	// a retried destructive read could lose the message of the failed attempt
+	resp, err := q.do(ctx, "ReceiveAndDelete", false, func() (*http.Request, error) {
+		return q.createRequest(ctx, "messages/head?timeout="+strconv.Itoa(q.Timeout), "DELETE")
+	})
+
+	if err != nil {
 		return nil, err
 	}
 
-	return parseMessage(resp)
+	defer resp.Body.Close()
+
+	return q.parseMessage(resp)
 }
 
 // Sends message to a Service Bus queue.
 func (q *QueueClient) SendMessage(msg *Message) error {
-	req, err := q.createRequestFromMessage("messages/", "POST", msg)
-
-	if err != nil {
-		return wrap(err, "Request create failed")
-	}
+	return q.SendMessageContext(context.Background(), msg)
+}
 
-	resp, err := q.getClient().Do(req)
+// SendMessageContext is like SendMessage but uses ctx for the request.
+// If ctx is done before the message is sent, ctx.Err() is returned.
+func (q *QueueClient) SendMessageContext(ctx context.Context, msg *Message) error {
+	// without a MessageId duplicate detection can't discard the message of a failed attempt
+	resp, err := q.do(ctx, "SendMessage", msg.Id != "", func() (*http.Request, error) {
+		return q.createRequestFromMessage(ctx, "messages/", "POST", msg)
+	})
 
 	if err != nil {
-		return wrap(err, "Sending POST createRequest failed")
+		return err
 	}
 
-	defer resp.Body.Close()
-
-	return handleStatusCode(resp)
+	return resp.Body.Close()
 }
 
 // Unlocks a message for processing by other receivers on a specified subscription.
@@ -168,21 +244,70 @@ func (q *QueueClient) SendMessage(msg *Message) error {
 //
 // For more information see https://docs.microsoft.com/en-us/rest/api/servicebus/unlock-message
 func (q *QueueClient) UnlockMessage(msg *Message) error {
-	req, err := q.createRequest("messages/"+msg.Id+"/"+msg.LockToken, "PUT")
+	return q.UnlockMessageContext(context.Background(), msg)
+}
+
+// UnlockMessageContext is like UnlockMessage but uses ctx for the request.
+// If ctx is done before the message is unlocked, ctx.Err() is returned.
+func (q *QueueClient) UnlockMessageContext(ctx context.Context, msg *Message) error {
+	if err := checkLock(msg); err != nil {
+		return err
+	}
+
+	resp, err := q.do(ctx, "UnlockMessage", true, func() (*http.Request, error) {
+		return q.createRequest(ctx, "messages/"+msg.Id+"/"+msg.LockToken, "PUT")
+	})
 
 	if err != nil {
-		return wrap(err, "Request create failed")
+		return lockError(msg, err)
+	}
+
+	return resp.Body.Close()
+}
+
+// Extends the lock of a message by the lock duration specified in the queue description
+// and updates msg.LockedUntilUtc accordingly.
+// Before the operation is called, a receiver must first lock the message.
+//
+// For more information see https://docs.microsoft.com/en-us/rest/api/servicebus/renew-lock-for-a-message
+func (q *QueueClient) RenewLock(msg *Message) error {
+	return q.RenewLockContext(context.Background(), msg)
+}
+
+// RenewLockContext is like RenewLock but uses ctx for the request.
+// If ctx is done before the lock is renewed, ctx.Err() is returned.
+func (q *QueueClient) RenewLockContext(ctx context.Context, msg *Message) error {
+	if err := checkLock(msg); err != nil {
+		return err
 	}
 
-	resp, err := q.getClient().Do(req)
+	renewedAt := time.Now()
+	resp, err := q.do(ctx, "RenewLock", true, func() (*http.Request, error) {
+		return q.createRequest(ctx, "messages/"+msg.Id+"/"+msg.LockToken, "POST")
+	})
 
 	if err != nil {
-		return wrap(err, "Sending PUT createRequest failed")
+		return lockError(msg, err)
 	}
 
 	defer resp.Body.Close()
 
-	return handleStatusCode(resp)
+	renewed := Message{}
+	if p := resp.Header.Get(headerBrokerProperties); len(p) > 0 {
+		q.parseBrokerProperties(&renewed, p)
+	}
+
+	if !renewed.LockedUntilUtc.IsZero() {
+		msg.LockedUntilUtc = renewed.LockedUntilUtc
+	} else if q.LockDuration > 0 {
+		msg.LockedUntilUtc = renewedAt.Add(q.LockDuration).UTC()
+	}
+
+	if msg.renewed != nil {
+		msg.renewed.extend(msg.LockedUntilUtc)
+	}
+
+	return nil
 }
 
 // This operation completes the processing of a locked message and deletes it from the queue or subscription.
@@ -191,46 +316,82 @@ func (q *QueueClient) UnlockMessage(msg *Message) error {
 //
 // For more information see https://docs.microsoft.com/en-us/rest/api/servicebus/delete-message
 func (q *QueueClient) DeleteMessage(msg *Message) error {
-	req, err := q.createRequest("messages/"+msg.Id+"/"+msg.LockToken, "DELETE")
+	return q.DeleteMessageContext(context.Background(), msg)
+}
 
-	if err != nil {
-		return wrap(err, "Request create failed")
+// DeleteMessageContext is like DeleteMessage but uses ctx for the request.
+// If ctx is done before the message is deleted, ctx.Err() is returned.
+func (q *QueueClient) DeleteMessageContext(ctx context.Context, msg *Message) error {
+	if err := checkLock(msg); err != nil {
+		return err
 	}
 
-	resp, err := q.getClient().Do(req)
+	resp, err := q.do(ctx, "DeleteMessage", true, func() (*http.Request, error) {
+		return q.createRequest(ctx, "messages/"+msg.Id+"/"+msg.LockToken, "DELETE")
+	})
 
 	if err != nil {
-		return wrap(err, "Sending DELETE createRequest failed")
+		return lockError(msg, err)
 	}
 
-	defer resp.Body.Close()
+	return resp.Body.Close()
+}
+
+// Host suffixes of the Service Bus namespaces in the Azure clouds.
+const (
+	PublicCloudSuffix       = "servicebus.windows.net"
+	ChinaCloudSuffix        = "servicebus.chinacloudapi.cn"
+	USGovernmentCloudSuffix = "servicebus.usgovcloudapi.net"
+	GermanCloudSuffix       = "servicebus.cloudapi.de"
+)
+
+// Returns the endpoint of a namespace in the cloud with the given host suffix.
+func NamespaceEndpoint(namespace string, suffix string) string {
+	return "https://" + namespace + "." + suffix + ":443"
+}
+
+// Returns the base URL of the namespace.
+func (q *QueueClient) baseURL() string {
+	if q.Endpoint != "" {
+		return strings.TrimSuffix(q.Endpoint, "/")
+	}
 
-	return handleStatusCode(resp)
+	return NamespaceEndpoint(q.Namespace, PublicCloudSuffix)
 }
 
-const azureQueueURL = "https://%s.servicebus.windows.net:443/%s/"
+func (q *QueueClient) createRequest(ctx context.Context, path string, method string) (*http.Request, error) {
+	return q.createRequestWithBody(ctx, path, method, nil)
+}
 
-func (q *QueueClient) createRequest(path string, method string) (*http.Request, error) {
-	url := fmt.Sprintf(azureQueueURL, q.Namespace, q.QueueName) + path
+func (q *QueueClient) createRequestWithBody(ctx context.Context, path string, method string, body io.Reader) (*http.Request, error) {
+	audience := q.baseURL() + "/" + q.entity() + "/"
 
-	req, err := http.NewRequest(method, url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, audience+path, body)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", q.makeAuthHeader(url, time.Now()))
+	token, err := q.getTokenProvider().Token(ctx, audience)
+	if err != nil {
+		return nil, wrap(err, "Token request failed")
+	}
+
+	req.Header.Set("Authorization", token.Value)
 	return req, nil
 }
 
-func (q *QueueClient) createRequestFromMessage(path string, method string, msg *Message) (*http.Request, error) {
-	url := fmt.Sprintf(azureQueueURL, q.Namespace, q.QueueName) + path
+func (q *QueueClient) createRequestFromMessage(ctx context.Context, path string, method string, msg *Message) (*http.Request, error) {
+	req, err := q.createRequestWithBody(ctx, path, method, bytes.NewBuffer(msg.Body))
+	if err != nil {
+		return nil, err
+	}
 
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(msg.Body))
+	properties, err := encodeProperties(msg)
 	if err != nil {
 		return nil, err
 	}
 
-	for k, v := range msg.Properties {
+	for k, v := range properties {
 		req.Header.Set(k, v)
 	}
 
@@ -248,53 +409,148 @@ func (q *QueueClient) createRequestFromMessage(path string, method string, msg *
 		req.Header.Set("Content-Type", msg.ContentType)
 	}
 
-	req.Header.Set("Authorization", q.makeAuthHeader(url, time.Now()))
 	return req, nil
 }
 
-func (q *QueueClient) getClient() HttpClient {
+// Returns the path of the entity the client talks to, relative to the namespace.
+func (q *QueueClient) entity() string {
+	if q.entityPath != "" {
+		return q.entityPath
+	}
 
-	if httpClientOverride != nil {
-		return httpClientOverride
+	return q.QueueName
+}
+
+// Returns a copy of the client talking to the entity at path.
+func (q *QueueClient) withEntity(path string) *QueueClient {
+	return &QueueClient{
+		Namespace:     q.Namespace,
+		Endpoint:      q.Endpoint,
+		KeyName:       q.KeyName,
+		KeyValue:      q.KeyValue,
+		QueueName:     q.QueueName,
+		TokenProvider: q.TokenProvider,
+		Timeout:       q.Timeout,
+		LockDuration:  q.LockDuration,
+		RetryPolicy:   q.RetryPolicy,
+		MaxBatchSize:  q.MaxBatchSize,
+		httpClient:    q.httpClient,
+		logger:        q.logger,
+		entityPath:    path,
 	}
+}
+
+// Returns the http client of the client, or else the one set with SetHttpClient, or else the package default.
+func (q *QueueClient) getClient() HttpClient {
 
 	if q.httpClient != nil {
 		return q.httpClient
 	}
 
-	q.mu.Lock()
-	defer q.mu.Unlock()
+	httpClientMu.RLock()
+	defer httpClientMu.RUnlock()
 
-	if q.httpClient == nil {
-		q.httpClient = &http.Client{}
+	if httpClientOverride != nil {
+		return httpClientOverride
+	}
+
+	return defaultHttpClient
+}
+
+// Returns the logger of the client, or else the package's logger, adding the queue to every record.
+func (q *QueueClient) log() internalLogger {
+	l := logger
+	if q.logger != nil {
+		l = *q.logger
 	}
 
-	return q.httpClient
+	return l.with("queue", q.entity())
 }
 
 // Creates an authenticaiton header with Shared Access Signature token.
 //
 // For more information see: https://docs.microsoft.com/en-us/azure/service-bus-messaging/service-bus-sas
 func (q *QueueClient) makeAuthHeader(uri string, from time.Time) string {
+	return q.keyProvider().sign(uri, from).Value
+}
+
+// Returns SHA-256 hash of the scope of the token with a CRLF appended and an expiry time.
+func (q *QueueClient) makeSignatureString(s string) string {
+	return q.keyProvider().signature(s)
+}
 
-	const expireInSeconds = 300
+func (q *QueueClient) keyProvider() *SharedAccessKeyProvider {
+	return &SharedAccessKeyProvider{KeyName: q.KeyName, KeyValue: q.KeyValue}
+}
 
-	epoch := from.Add(expireInSeconds * time.Second).Round(time.Second).Unix()
-	expiry := strconv.Itoa(int(epoch))
+func (q *QueueClient) getTokenProvider() TokenProvider {
+	if q.TokenProvider != nil {
+		return q.TokenProvider
+	}
 
-	// as per https://docs.microsoft.com/en-us/azure/service-bus-messaging/service-bus-sas
-	encodedUri := strings.ToLower(url.QueryEscape(uri))
-	sig := q.makeSignatureString(encodedUri + "\n" + expiry)
-	return fmt.Sprintf("SharedAccessSignature sig=%s&se=%s&skn=%s&sr=%s", sig, expiry, q.KeyName, encodedUri)
+	return q.keyProvider()
 }
 
-// Returns SHA-256 hash of the scope of the token with a CRLF appended and an expiry time.
-func (q *QueueClient) makeSignatureString(s string) string {
-	// as per https://docs.microsoft.com/en-us/azure/service-bus-messaging/service-bus-sas
-	h := hmac.New(sha256.New, []byte(q.KeyValue))
-	h.Write([]byte(s))
-	encodedSig := base64.StdEncoding.EncodeToString(h.Sum(nil))
-	return url.QueryEscape(encodedSig)
+// Sends the request created by newRequest and checks the response status code.
+// Transient failures are retried as per q.RetryPolicy, unless the operation isn't idempotent,
+// waiting at least as long as the service requests with Retry-After.
+// Errors of the service are returned as *ServiceBusError with the name of the operation.
+// On success the caller must close the response body.
+func (q *QueueClient) do(ctx context.Context, operation string, idempotent bool, newRequest func() (*http.Request, error)) (*http.Response, error) {
+
+	attempts := 1
+	if q.RetryPolicy != nil && idempotent {
+		attempts = q.RetryPolicy.MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+
+		if err != nil {
+			// e.g. a TokenProvider giving up on the done ctx
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, wrap(err, "Request create failed")
+		}
+
+		start := time.Now()
+		resp, err := q.getClient().Do(req)
+		latency := time.Since(start)
+
+		if err == nil {
+			q.log().Debug("Response", "operation", operation, "method", req.Method, "attempt", attempt, "status_code", resp.StatusCode, "latency", latency)
+
+			if err = handleStatusCode(resp); err == nil {
+				return resp, nil
+			}
+			resp.Body.Close()
+			err.(*ServiceBusError).Operation = operation
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if attempt >= attempts || !q.RetryPolicy.retryable(err) {
+			if resp == nil {
+				return nil, wrap(err, "Sending "+req.Method+" createRequest failed")
+			}
+			return nil, err
+		}
+
+		delay := q.RetryPolicy.delay(attempt)
+		if d := retryAfter(err); d > delay {
+			delay = d
+		}
+		q.log().Debug("Retrying", "operation", operation, "attempt", attempt, "delay", delay, "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
 }
 
 func handleStatusCode(resp *http.Response) error {
@@ -305,33 +561,43 @@ func handleStatusCode(resp *http.Response) error {
 
 	body, _ := ioutil.ReadAll(resp.Body)
 
+	var err error
+
 	switch resp.StatusCode {
 	case 204:
-		return NoMessagesAvailableError{204, string(body)}
+		err = NoMessagesAvailableError{204, string(body)}
 	case 400:
-		return BadRequestError{400, string(body)}
+		err = BadRequestError{400, string(body)}
 	case 401:
-		return NotAuthorizedError{401, string(body)}
+		err = NotAuthorizedError{401, string(body)}
 	case 404:
-		return MessageDontExistError{404, string(body)}
+		err = MessageDontExistError{404, string(body)}
+	case 403:
+		err = QuotaExceededError{403, string(body)}
+	case 409:
+		err = ConflictError{409, string(body)}
 	case 410:
-		return QueueDontExistError{410, string(body)}
+		err = QueueDontExistError{410, string(body)}
+	case 413:
+		err = EntityTooLargeError{413, string(body)}
+	case 429:
+		err = ThrottledError{429, string(body)}
 	case 500:
-		return InternalError{500, string(body)}
+		err = InternalError{500, string(body)}
+	case 503:
+		err = ServerBusyError{503, string(body)}
+	default:
+		err = unknownStatusError{resp.StatusCode, string(body)}
 	}
 
-	return fmt.Errorf("Unknown status %v with body %v", resp.StatusCode, string(body))
+	return newServiceBusError(resp, body, err)
 }
 
-func parseMessage(resp *http.Response) (*Message, error) {
-
-	logger.Debug("Response StatusCode ", resp.StatusCode)
-	logger.Debug("Response Status ", resp.Status)
-	logger.Debug("Response Header ", resp.Header)
-	logger.Debug("Response ContentLength ", resp.ContentLength)
+func (q *QueueClient) parseMessage(resp *http.Response) (*Message, error) {
 
 	m := Message{
-		Properties: Properties{},
+		Properties:      Properties{},
+		TypedProperties: TypedProperties{},
 	}
 
 	parseHeaders(&m, resp)
@@ -339,7 +605,7 @@ func parseMessage(resp *http.Response) (*Message, error) {
 	brokerProperties := resp.Header.Get(headerBrokerProperties)
 
 	if len(brokerProperties) > 0 {
-		parseBrokerProperties(&m, brokerProperties)
+		q.parseBrokerProperties(&m, brokerProperties)
 	}
 
 	value, err := ioutil.ReadAll(resp.Body)
@@ -350,14 +616,16 @@ func parseMessage(resp *http.Response) (*Message, error) {
 
 	m.Body = value
 
+	q.log().Debug("Message read", "message_id", m.Id, "sequence_number", m.SequenceNumber, "delivery_count", m.DeliveryCount)
+
 	return &m, nil
 }
 
 func parseHeaders(m *Message, resp *http.Response) {
 	for k, v := range resp.Header {
 
-		switch k {
-		case headerBrokerProperties:
+		switch textproto.CanonicalMIMEHeaderKey(k) {
+		case textproto.CanonicalMIMEHeaderKey(headerBrokerProperties):
 			{
 				continue
 			}
@@ -373,22 +641,42 @@ func parseHeaders(m *Message, resp *http.Response) {
 				}
 				continue
 			}
+		case textproto.CanonicalMIMEHeaderKey(headerDeadLetterReason):
+			{
+				m.DeadLetterReason = strings.Trim(v[0], "\"")
+				continue
+			}
+		case textproto.CanonicalMIMEHeaderKey(headerDeadLetterErrorDescription):
+			{
+				m.DeadLetterErrorDescription = strings.Trim(v[0], "\"")
+				continue
+			}
 		default:
 			{
-				// azure returns customer headers quoted
-				m.Properties.Set(k, strings.Trim(v[0], "\""))
+				// azure returns custom properties JSON encoded, strings and dates quoted
+				key := textproto.CanonicalMIMEHeaderKey(k)
+				value := decodeProperty(v[0])
+				m.Properties[key] = formatProperty(value)
+
+				if m.TypedProperties == nil {
+					m.TypedProperties = TypedProperties{}
+				}
+				m.TypedProperties[key] = value
+
+				if m.receivedProperties == nil {
+					m.receivedProperties = map[string]string{}
+				}
+				m.receivedProperties[key] = m.Properties[key]
 			}
 		}
 	}
 }
 
-func parseBrokerProperties(m *Message, properties string) {
-
-	logger.Debug("Response BrokerProperties ", properties)
+func (q *QueueClient) parseBrokerProperties(m *Message, properties string) {
 
 	p := brokerProperties{}
 	if err := json.Unmarshal([]byte(properties), &p); err != nil {
-		logger.Error("BrokerProperties header parse failed", err)
+		q.log().Error("BrokerProperties header parse failed", "error", err)
 		return
 	}
 
@@ -475,7 +763,7 @@ func (p *brokerProperties) CopyFromMessage(msg *Message) {
 
 	defaultTime := time.Time{}
 	if msg.ScheduledEnqueueTimeUtc != defaultTime {
-		p.ScheduledEnqueueTimeUtc = msg.ScheduledEnqueueTimeUtc.Format(Rfc2616Time)
+		p.ScheduledEnqueueTimeUtc = msg.ScheduledEnqueueTimeUtc.UTC().Format(http.TimeFormat)
 	}
 }
 
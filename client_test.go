@@ -2,13 +2,16 @@ package queue
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"reflect"
 	"strconv"
-	"sync"
+	"strings"
 	"testing"
 	"time"
 )
@@ -19,7 +22,6 @@ var q = QueueClient{
 	KeyValue:   "keyvalue",
 	QueueName:  "test",
 	Timeout:    0,
-	mu:         sync.Mutex{},
 	httpClient: nil}
 
 var loc, _ = time.LoadLocation("GMT")
@@ -62,8 +64,14 @@ var errorTestCases = []errorCase{
 	errorCase{400, reflect.TypeOf(BadRequestError{}), "400"},
 	errorCase{401, reflect.TypeOf(NotAuthorizedError{}), "401"},
 	errorCase{404, reflect.TypeOf(MessageDontExistError{}), "404"},
+	errorCase{403, reflect.TypeOf(QuotaExceededError{}), "403"},
+	errorCase{409, reflect.TypeOf(ConflictError{}), "409"},
 	errorCase{410, reflect.TypeOf(QueueDontExistError{}), "410"},
+	errorCase{413, reflect.TypeOf(EntityTooLargeError{}), "413"},
+	errorCase{429, reflect.TypeOf(ThrottledError{}), "429"},
 	errorCase{500, reflect.TypeOf(InternalError{}), "500"},
+	errorCase{503, reflect.TypeOf(ServerBusyError{}), "503"},
+	errorCase{501, reflect.TypeOf(unknownStatusError{}), "501"},
 }
 
 func TestMain(m *testing.M) {
@@ -78,7 +86,7 @@ func Test_createRequest(t *testing.T) {
 	host := "test.servicebus.windows.net:443"
 	method := "POST"
 
-	req, err := q.createRequest("messages/head?timeout=0", method)
+	req, err := q.createRequest(context.Background(), "messages/head?timeout=0", method)
 
 	if err != nil {
 		t.Fatal(err)
@@ -93,12 +101,44 @@ func Test_createRequest(t *testing.T) {
 	}
 }
 
+func Test_createRequest_endpoint(t *testing.T) {
+
+	tests := []struct {
+		endpoint string
+		url      string
+	}{
+		{"", "https://test.servicebus.windows.net:443/test/messages/head"},
+		{NamespaceEndpoint("test", ChinaCloudSuffix), "https://test.servicebus.chinacloudapi.cn:443/test/messages/head"},
+		{"http://localhost:8080/", "http://localhost:8080/test/messages/head"},
+	}
+
+	for _, test := range tests {
+		cli := QueueClient{Namespace: "test", KeyName: "key", KeyValue: "keyvalue", QueueName: "test", Endpoint: test.endpoint}
+
+		req, err := cli.createRequest(context.Background(), "messages/head", "POST")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if req.URL.String() != test.url {
+			t.Fatalf("Expected URL %s but got %s", test.url, req.URL)
+		}
+
+		// the SAS audience is the entity URL
+		audience := strings.ToLower(url.QueryEscape(strings.TrimSuffix(test.url, "messages/head")))
+		if !strings.HasSuffix(req.Header.Get("Authorization"), "&sr="+audience) {
+			t.Fatalf("Expected Authorization for audience %s but got %s", audience, req.Header.Get("Authorization"))
+		}
+	}
+}
+
 func Test_createRequestFromMessage(t *testing.T) {
 
 	host := "test.servicebus.windows.net:443"
 	method := "POST"
 
-	req, err := q.createRequestFromMessage("messages/abc/efg", method, &testMsg)
+	req, err := q.createRequestFromMessage(context.Background(), "messages/abc/efg", method, &testMsg)
 
 	if err != nil {
 		t.Fatal(err)
@@ -113,8 +153,8 @@ func Test_createRequestFromMessage(t *testing.T) {
 	}
 
 	for k, _ := range testMsg.Properties {
-		if req.Header.Get(k) != testMsg.Properties[k] {
-			t.Fatalf("Expected header %s value %s but got %s", k, testMsg.Properties[k], req.Header.Get(k))
+		if req.Header.Get(k) != strconv.Quote(testMsg.Properties.Get(k)) {
+			t.Fatalf("Expected header %s value %q but got %s", k, testMsg.Properties.Get(k), req.Header.Get(k))
 		}
 	}
 }
@@ -130,7 +170,7 @@ func Test_parseMessage(t *testing.T) {
 		Body: ioutil.NopCloser(bytes.NewBufferString("Hello World")),
 	}
 
-	msg, err := parseMessage(&resp)
+	msg, err := q.parseMessage(&resp)
 
 	if err != nil {
 		t.Error(err)
@@ -167,7 +207,7 @@ func Test_parseBrokerProperties(t *testing.T) {
 
 	msg := &Message{}
 
-	parseBrokerProperties(msg, brokerProps)
+	q.parseBrokerProperties(msg, brokerProps)
 	msg.EnqueuedTimeUtc = testMsg.EnqueuedTimeUtc
 
 	compareMsg(t, &testMsg, msg, true)
@@ -205,8 +245,8 @@ func Test_handleStatusCode_error(t *testing.T) {
 			t.Fatalf("Expected error type %s but got nil", tCase.Error)
 		}
 
-		if reflect.TypeOf(err) != tCase.Error {
-			t.Fatalf("Expected error type %s but got %s", tCase.Error, reflect.TypeOf(err))
+		if !errors.As(err, reflect.New(tCase.Error).Interface()) {
+			t.Fatalf("Expected error type %s but got %v", tCase.Error, err)
 		}
 	}
 }
@@ -266,6 +306,98 @@ func Test_getClient_default(t *testing.T) {
 	}
 }
 
+type httpClientFunc func(req *http.Request) (*http.Response, error)
+
+func (f httpClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func Test_ReceiveAndDelete(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != "DELETE" || req.URL.Path != "/test/messages/head" || req.URL.Query().Get("timeout") != "0" {
+			t.Fatalf("Unexpected request %s %s", req.Method, req.URL)
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Brokerproperties": []string{brokerProps}},
+			Body:       ioutil.NopCloser(bytes.NewBufferString("Hello World")),
+		}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	msg, err := q.ReceiveAndDelete()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(msg.Body) != "Hello World" {
+		t.Fatalf("Expected body %s but got %s", "Hello World", string(msg.Body))
+	}
+
+	if msg.Id != testMsg.Id {
+		t.Fatalf("Expected MessageId %s but got %s", testMsg.Id, msg.Id)
+	}
+}
+
+func Test_ReceiveAndDelete_noMessages(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusNoContent, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	if _, err := q.ReceiveAndDelete(); !errors.As(err, &NoMessagesAvailableError{}) {
+		t.Fatalf("Expected %T but got %v", NoMessagesAvailableError{}, err)
+	}
+}
+
+func Test_Context_cancelled(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, fmt.Errorf("net/http: request canceled")
+	}))
+	defer SetHttpClient(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := q.GetMessageContext(ctx); err != context.Canceled {
+		t.Fatalf("Expected GetMessageContext error %v but got %v", context.Canceled, err)
+	}
+
+	if err := q.SendMessageContext(ctx, NewMessage([]byte("hello"))); err != context.Canceled {
+		t.Fatalf("Expected SendMessageContext error %v but got %v", context.Canceled, err)
+	}
+
+	if err := q.UnlockMessageContext(ctx, &testMsg); err != context.Canceled {
+		t.Fatalf("Expected UnlockMessageContext error %v but got %v", context.Canceled, err)
+	}
+
+	if err := q.DeleteMessageContext(ctx, &testMsg); err != context.Canceled {
+		t.Fatalf("Expected DeleteMessageContext error %v but got %v", context.Canceled, err)
+	}
+}
+
+func Test_Context_deadline(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, fmt.Errorf("net/http: request canceled")
+	}))
+	defer SetHttpClient(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := q.GetMessageContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected error %v but got %v", context.DeadlineExceeded, err)
+	}
+}
+
 func Test_Properties(t *testing.T) {
 
 	tests := []struct {
@@ -332,7 +464,6 @@ func Test_SendReceive(t *testing.T) {
 		KeyValue:   keyValue,
 		QueueName:  queueName,
 		Timeout:    60,
-		mu:         sync.Mutex{},
 		httpClient: &http.Client{},
 	}
 
@@ -0,0 +1,229 @@
+package queue
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeRaw      = "application/octet-stream"
+)
+
+// Codec encodes values into message bodies and decodes them back, for one content type.
+type Codec interface {
+	// Content type of the encoded bodies, set as Message.ContentType.
+	ContentType() string
+
+	Marshal(v interface{}) ([]byte, error)
+
+	// Decodes data into v, which must be a pointer.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes values with encoding/json.
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtoCodec encodes protobuf messages without depending on a protobuf library.
+// Values must implement Marshal() ([]byte, error) and Unmarshal([]byte) error, as generated by gogo/protobuf,
+// or encoding.BinaryMarshaler and encoding.BinaryUnmarshaler.
+// For other generated types wrap proto.Marshal and proto.Unmarshal in a Codec with ContentType ContentTypeProtobuf.
+type ProtoCodec struct{}
+
+type protoMarshaler interface {
+	Marshal() ([]byte, error)
+}
+
+type protoUnmarshaler interface {
+	Unmarshal([]byte) error
+}
+
+func (ProtoCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	switch m := v.(type) {
+	case protoMarshaler:
+		return m.Marshal()
+	case encoding.BinaryMarshaler:
+		return m.MarshalBinary()
+	}
+
+	return nil, fmt.Errorf("%T doesn't implement Marshal() ([]byte, error) or encoding.BinaryMarshaler", v)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case protoUnmarshaler:
+		return m.Unmarshal(data)
+	case encoding.BinaryUnmarshaler:
+		return m.UnmarshalBinary(data)
+	}
+
+	return fmt.Errorf("%T doesn't implement Unmarshal([]byte) error or encoding.BinaryUnmarshaler", v)
+}
+
+// RawCodec passes []byte and string values through unchanged.
+type RawCodec struct{}
+
+func (RawCodec) ContentType() string {
+	return ContentTypeRaw
+}
+
+func (RawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	}
+
+	return nil, fmt.Errorf("RawCodec can't encode %T, only []byte and string", v)
+}
+
+func (RawCodec) Unmarshal(data []byte, v interface{}) error {
+	switch b := v.(type) {
+	case *[]byte:
+		*b = data
+		return nil
+	case *string:
+		*b = string(data)
+		return nil
+	}
+
+	return fmt.Errorf("RawCodec can't decode into %T, only *[]byte and *string", v)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		ContentTypeJSON:     JSONCodec{},
+		ContentTypeProtobuf: ProtoCodec{},
+		ContentTypeRaw:      RawCodec{},
+	}
+)
+
+// Registers a codec used by Decode for messages with its content type, replacing the codec registered for it.
+// JSONCodec, ProtoCodec and RawCodec are registered by default.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	codecs[mediaType(c.ContentType())] = c
+}
+
+func codecFor(contentType string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, ok := codecs[mediaType(contentType)]
+	return c, ok
+}
+
+// Returns the content type without parameters such as charset, lower cased.
+func mediaType(contentType string) string {
+	if t, _, err := mime.ParseMediaType(contentType); err == nil {
+		return t
+	}
+
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// Creates a message with v encoded by c as body and ContentType set to the content type of c.
+// Send it with SendMessage, the batch format of SendBatch has no content type.
+func NewMessageWithCodec(c Codec, v interface{}) (*Message, error) {
+	body, err := c.Marshal(v)
+	if err != nil {
+		return nil, wrap(err, "Message encode failed")
+	}
+
+	msg := NewMessage(body)
+	msg.ContentType = c.ContentType()
+
+	return msg, nil
+}
+
+// Sends v encoded as JSON with ContentType application/json.
+func (q *QueueClient) SendJSON(v interface{}) error {
+	return q.SendJSONContext(context.Background(), v)
+}
+
+// SendJSONContext is like SendJSON but uses ctx for the request.
+func (q *QueueClient) SendJSONContext(ctx context.Context, v interface{}) error {
+	msg, err := NewMessageWithCodec(JSONCodec{}, v)
+	if err != nil {
+		return err
+	}
+
+	return q.SendMessageContext(ctx, msg)
+}
+
+// Sends v encoded as JSON to the topic, see QueueClient.SendJSON.
+func (t *TopicClient) SendJSON(v interface{}) error {
+	return t.q.SendJSON(v)
+}
+
+// SendJSONContext is like SendJSON but uses ctx for the request.
+func (t *TopicClient) SendJSONContext(ctx context.Context, v interface{}) error {
+	return t.q.SendJSONContext(ctx, v)
+}
+
+// Decodes the body of msg with the codec registered for its ContentType.
+// A ContentTypeError is returned if no codec is registered for it, including when ContentType is empty.
+func Decode[T any](msg *Message) (T, error) {
+	c, ok := codecFor(msg.ContentType)
+	if !ok {
+		var v T
+		return v, ContentTypeError{Actual: msg.ContentType}
+	}
+
+	return decode[T](msg, c)
+}
+
+// Decodes the body of msg with c, after checking that msg.ContentType is the content type of c.
+// A ContentTypeError is returned if it isn't.
+func DecodeWith[T any](msg *Message, c Codec) (T, error) {
+	if mediaType(msg.ContentType) != mediaType(c.ContentType()) {
+		var v T
+		return v, ContentTypeError{Expected: c.ContentType(), Actual: msg.ContentType}
+	}
+
+	return decode[T](msg, c)
+}
+
+func decode[T any](msg *Message, c Codec) (T, error) {
+	var v T
+
+	// a pointer type is decoded into a new value, as codecs like ProtoCodec can't allocate it
+	target := interface{}(&v)
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Ptr {
+		reflect.ValueOf(&v).Elem().Set(reflect.New(t.Elem()))
+		target = v
+	}
+
+	if err := c.Unmarshal(msg.Body, target); err != nil {
+		return v, wrap(err, "Message decode failed")
+	}
+
+	return v, nil
+}
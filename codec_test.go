@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type order struct {
+	Id    string
+	Items int
+}
+
+// protobuf-style message with gogo/protobuf method signatures
+type protoOrder struct {
+	id string
+}
+
+func (o *protoOrder) Marshal() ([]byte, error) {
+	return []byte(o.id), nil
+}
+
+func (o *protoOrder) Unmarshal(b []byte) error {
+	if len(b) == 0 {
+		return errors.New("empty")
+	}
+	o.id = string(b)
+	return nil
+}
+
+func Test_SendJSON(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get(headerContentType) != ContentTypeJSON {
+			t.Fatalf("Expected Content-Type %s but got %s", ContentTypeJSON, req.Header.Get(headerContentType))
+		}
+
+		body, _ := ioutil.ReadAll(req.Body)
+		if string(body) != `{"Id":"1","Items":2}` {
+			t.Fatalf("Unexpected body %s", body)
+		}
+
+		return &http.Response{StatusCode: http.StatusCreated, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	if err := q.SendJSON(order{"1", 2}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_Decode(t *testing.T) {
+
+	msg, err := NewMessageWithCodec(JSONCodec{}, order{"1", 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg.ContentType = "application/json; charset=utf-8"
+
+	v, err := Decode[order](msg)
+	if err != nil || v != (order{"1", 2}) {
+		t.Fatalf("Expected order 1 but got %+v, %v", v, err)
+	}
+
+	p, err := Decode[*order](msg)
+	if err != nil || *p != (order{"1", 2}) {
+		t.Fatalf("Expected order 1 but got %+v, %v", p, err)
+	}
+
+	if _, err := DecodeWith[order](msg, JSONCodec{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DecodeWith[*protoOrder](msg, ProtoCodec{}); reflect.TypeOf(err) != reflect.TypeOf(ContentTypeError{}) {
+		t.Fatalf("Expected error type %s but got %s", reflect.TypeOf(ContentTypeError{}), reflect.TypeOf(err))
+	}
+
+	if _, err := Decode[order](NewMessage([]byte("{}"))); reflect.TypeOf(err) != reflect.TypeOf(ContentTypeError{}) {
+		t.Fatalf("Expected error type %s but got %s", reflect.TypeOf(ContentTypeError{}), reflect.TypeOf(err))
+	}
+}
+
+func Test_ProtoCodec(t *testing.T) {
+
+	msg, err := NewMessageWithCodec(ProtoCodec{}, &protoOrder{"1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.ContentType != ContentTypeProtobuf || string(msg.Body) != "1" {
+		t.Fatalf("Expected protobuf message but got %s %s", msg.ContentType, msg.Body)
+	}
+
+	p, err := Decode[*protoOrder](msg)
+	if err != nil || p.id != "1" {
+		t.Fatalf("Expected order 1 but got %+v, %v", p, err)
+	}
+
+	if _, err := NewMessageWithCodec(ProtoCodec{}, order{}); err == nil {
+		t.Fatal("Expected error encoding a value that isn't a protobuf message")
+	}
+
+	if _, err := Decode[*protoOrder](&Message{ContentType: ContentTypeProtobuf}); err == nil {
+		t.Fatal("Expected decode error to be returned")
+	}
+}
+
+func Test_RawCodec(t *testing.T) {
+
+	msg, err := NewMessageWithCodec(RawCodec{}, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := Decode[string](msg); err != nil || s != "hello" {
+		t.Fatalf("Expected hello but got %s, %v", s, err)
+	}
+
+	if b, err := Decode[[]byte](msg); err != nil || string(b) != "hello" {
+		t.Fatalf("Expected hello but got %s, %v", b, err)
+	}
+
+	if _, err := NewMessageWithCodec(RawCodec{}, 1); err == nil {
+		t.Fatal("Expected error encoding an int")
+	}
+}
+
+type upperCodec struct{ RawCodec }
+
+func (upperCodec) ContentType() string {
+	return "text/x-upper"
+}
+
+func Test_RegisterCodec(t *testing.T) {
+
+	RegisterCodec(upperCodec{})
+
+	s, err := Decode[string](&Message{ContentType: "Text/X-Upper", Body: []byte("HELLO")})
+	if err != nil || s != "HELLO" {
+		t.Fatalf("Expected HELLO but got %s, %v", s, err)
+	}
+}
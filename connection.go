@@ -0,0 +1,154 @@
+package queue
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	connectionStringEndpoint              = "Endpoint"
+	connectionStringSharedAccessKeyName   = "SharedAccessKeyName"
+	connectionStringSharedAccessKey       = "SharedAccessKey"
+	connectionStringSharedAccessSignature = "SharedAccessSignature"
+	connectionStringEntityPath            = "EntityPath"
+)
+
+// Creates a client from a Service Bus connection string of any Azure cloud, emulator or local stand-in, e.g.
+//
+//	Endpoint=sb://<yournamespace>.servicebus.windows.net/;SharedAccessKeyName=<policy>;SharedAccessKey=<key>;EntityPath=<queue>
+//
+// A pre-generated token can be supplied with SharedAccessSignature instead of SharedAccessKeyName and SharedAccessKey.
+// Keys are case insensitive and unrecognized keys are ignored.
+// A ConnectionStringError reports the key that is missing or malformed.
+// opts are applied after the connection string, e.g. to set the http client or retry policy.
+// Namespace connection strings without EntityPath need the queue name passed with WithQueueName.
+func NewQueueClientFromConnectionString(connectionString string, opts ...Option) (*QueueClient, error) {
+
+	values, err := parseConnectionString(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &QueueClient{}
+
+	endpoint, ok := values[connectionStringEndpoint]
+	if !ok {
+		return nil, ConnectionStringError{connectionStringEndpoint, "missing"}
+	}
+
+	if q.Namespace, q.Endpoint, err = parseEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+
+	q.QueueName = values[connectionStringEntityPath]
+	if _, ok := values[connectionStringEntityPath]; ok && q.QueueName == "" {
+		return nil, ConnectionStringError{connectionStringEntityPath, "empty value"}
+	}
+
+	if sas, ok := values[connectionStringSharedAccessSignature]; ok {
+		if q.TokenProvider, err = NewSharedAccessSignatureProvider(sas); err != nil {
+			return nil, ConnectionStringError{connectionStringSharedAccessSignature, err.Error()}
+		}
+	} else {
+		q.KeyName, ok = values[connectionStringSharedAccessKeyName]
+		if !ok || q.KeyName == "" {
+			return nil, ConnectionStringError{connectionStringSharedAccessKeyName, "missing"}
+		}
+
+		q.KeyValue, ok = values[connectionStringSharedAccessKey]
+		if !ok || q.KeyValue == "" {
+			return nil, ConnectionStringError{connectionStringSharedAccessKey, "missing"}
+		}
+	}
+
+	withOptions(q, opts)
+
+	// requests without a queue would go to the namespace root
+	if q.QueueName == "" {
+		return nil, ConnectionStringError{connectionStringEntityPath, "missing, pass the queue name with WithQueueName"}
+	}
+
+	return q, nil
+}
+
+// Splits a connection string into its recognized keys and values.
+func parseConnectionString(connectionString string) (map[string]string, error) {
+
+	recognized := []string{
+		connectionStringEndpoint,
+		connectionStringSharedAccessKeyName,
+		connectionStringSharedAccessKey,
+		connectionStringSharedAccessSignature,
+		connectionStringEntityPath,
+	}
+
+	values := map[string]string{}
+
+	for _, part := range strings.Split(connectionString, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		// values such as base64 encoded keys may contain '='
+		i := strings.Index(part, "=")
+		if i <= 0 {
+			return nil, ConnectionStringError{part, "expected key=value"}
+		}
+
+		key, value := strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+
+		for _, r := range recognized {
+			if strings.EqualFold(key, r) {
+				if _, ok := values[r]; ok {
+					return nil, ConnectionStringError{r, "duplicate key"}
+				}
+				values[r] = value
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// Returns the namespace name and the client endpoint of a connection string endpoint
+// such as sb://<yournamespace>.servicebus.windows.net/. The endpoint is empty for the public cloud.
+// The sb scheme maps to https, http endpoints are kept for emulators and local stand-ins.
+func parseEndpoint(endpoint string) (string, string, error) {
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", ConnectionStringError{connectionStringEndpoint, err.Error()}
+	}
+
+	scheme := u.Scheme
+	switch scheme {
+	case "sb":
+		scheme = "https"
+	case "https", "http":
+	default:
+		return "", "", ConnectionStringError{connectionStringEndpoint, "expected sb://, https:// or http:// scheme"}
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return "", "", ConnectionStringError{connectionStringEndpoint, "missing host"}
+	}
+
+	namespace := strings.Split(host, ".")[0]
+
+	if scheme == "https" && u.Port() == "" && host == namespace+"."+PublicCloudSuffix {
+		return namespace, "", nil
+	}
+
+	port := u.Port()
+	if port == "" && scheme == "https" {
+		port = "443"
+	}
+
+	if port == "" {
+		return namespace, scheme + "://" + host, nil
+	}
+
+	return namespace, scheme + "://" + host + ":" + port, nil
+}
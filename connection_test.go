@@ -0,0 +1,138 @@
+package queue
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_NewQueueClientFromConnectionString(t *testing.T) {
+
+	cli, err := NewQueueClientFromConnectionString("Endpoint=sb://my-test.servicebus.windows.net/;SharedAccessKeyName=RootManageSharedAccessKey;SharedAccessKey=ErCWbtgArb55Tqqu9tXgdCtopbZ44pMH01sjpMrYGrE=;EntityPath=my-queue")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cli.Namespace != "my-test" {
+		t.Fatalf("Expected Namespace %s but got %s", "my-test", cli.Namespace)
+	}
+
+	if cli.KeyName != "RootManageSharedAccessKey" {
+		t.Fatalf("Expected KeyName %s but got %s", "RootManageSharedAccessKey", cli.KeyName)
+	}
+
+	if cli.KeyValue != "ErCWbtgArb55Tqqu9tXgdCtopbZ44pMH01sjpMrYGrE=" {
+		t.Fatalf("Expected KeyValue %s but got %s", "ErCWbtgArb55Tqqu9tXgdCtopbZ44pMH01sjpMrYGrE=", cli.KeyValue)
+	}
+
+	if cli.QueueName != "my-queue" {
+		t.Fatalf("Expected QueueName %s but got %s", "my-queue", cli.QueueName)
+	}
+}
+
+func Test_NewQueueClientFromConnectionString_sharedAccessSignature(t *testing.T) {
+
+	sas := "SharedAccessSignature sr=https%3a%2f%2fmy-test.servicebus.windows.net%2fmy-queue&sig=abc%3D&se=1514768761&skn=send"
+
+	cli, err := NewQueueClientFromConnectionString("endpoint=sb://my-test.servicebus.windows.net;sharedaccesssignature=" + sas + ";entitypath=my-queue;TransportType=Amqp")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := cli.createRequest(context.Background(), "messages/head", "POST")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Header.Get("Authorization") != sas {
+		t.Fatalf("Expected Authorization %s but got %s", sas, req.Header.Get("Authorization"))
+	}
+}
+
+func Test_NewQueueClientFromConnectionString_endpoint(t *testing.T) {
+
+	tests := []struct {
+		endpoint string
+		expected string
+	}{
+		{"sb://my-test.servicebus.windows.net/", ""},
+		{"https://my-test.servicebus.windows.net", ""},
+		{"sb://my-test.servicebus.chinacloudapi.cn/", "https://my-test.servicebus.chinacloudapi.cn:443"},
+		{"sb://my-test.servicebus.windows.net:5671/", "https://my-test.servicebus.windows.net:5671"},
+		{"http://localhost:8080", "http://localhost:8080"},
+	}
+
+	for _, test := range tests {
+		cli, err := NewQueueClientFromConnectionString("Endpoint="+test.endpoint+";SharedAccessKeyName=a;SharedAccessKey=b", WithQueueName("my-queue"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cli.Endpoint != test.expected {
+			t.Fatalf("Expected Endpoint %s for %s but got %s", test.expected, test.endpoint, cli.Endpoint)
+		}
+	}
+}
+
+func Test_NewQueueClientFromConnectionString_errors(t *testing.T) {
+
+	tests := []struct {
+		connectionString string
+		key              string
+	}{
+		{"SharedAccessKeyName=a;SharedAccessKey=b", "Endpoint"},
+		{"Endpoint=ftp://my-test.servicebus.windows.net/;SharedAccessKeyName=a;SharedAccessKey=b", "Endpoint"},
+		{"Endpoint=sb:///;SharedAccessKeyName=a;SharedAccessKey=b", "Endpoint"},
+		{"Endpoint=sb://my-test.servicebus.windows.net/;SharedAccessKey=b", "SharedAccessKeyName"},
+		{"Endpoint=sb://my-test.servicebus.windows.net/;SharedAccessKeyName=a", "SharedAccessKey"},
+		{"Endpoint=sb://my-test.servicebus.windows.net/;SharedAccessKeyName=a;SharedAccessKey=b;EntityPath=", "EntityPath"},
+		{"Endpoint=sb://my-test.servicebus.windows.net/;SharedAccessKeyName=a;SharedAccessKey=b", "EntityPath"},
+		{"Endpoint=sb://my-test.servicebus.windows.net/;SharedAccessSignature=sig=abc", "SharedAccessSignature"},
+		{"Endpoint=sb://my-test.servicebus.windows.net/;SharedAccessSignature=SharedAccessSignature sig=abc&se=1", "SharedAccessSignature"},
+		{"Endpoint=sb://my-test.servicebus.windows.net/;Endpoint=sb://other.servicebus.windows.net/", "Endpoint"},
+		{"Endpoint=sb://my-test.servicebus.windows.net/;garbage", "garbage"},
+	}
+
+	for _, test := range tests {
+		_, err := NewQueueClientFromConnectionString(test.connectionString)
+
+		e, ok := err.(ConnectionStringError)
+		if !ok {
+			t.Fatalf("Expected ConnectionStringError for %s but got %v", test.connectionString, err)
+		}
+
+		if e.Key != test.key {
+			t.Fatalf("Expected malformed key %s for %s but got %s", test.key, test.connectionString, e.Key)
+		}
+	}
+}
+
+func Test_NewQueueClientFromConnectionString_options(t *testing.T) {
+
+	cli, err := NewQueueClientFromConnectionString("Endpoint=sb://my-test.servicebus.windows.net/;SharedAccessKeyName=RootManageSharedAccessKey;SharedAccessKey=abc;EntityPath=my-queue",
+		WithTimeout(30), WithRetryPolicy(testRetryPolicy))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cli.QueueName != "my-queue" || cli.Timeout != 30 || cli.RetryPolicy != testRetryPolicy {
+		t.Fatalf("Expected options to be applied but got %+v", cli)
+	}
+}
+
+func Test_NewQueueClientFromConnectionString_queueName(t *testing.T) {
+
+	cli, err := NewQueueClientFromConnectionString("Endpoint=sb://my-test.servicebus.windows.net/;SharedAccessKeyName=a;SharedAccessKey=b", WithQueueName("my-queue"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cli.QueueName != "my-queue" {
+		t.Fatalf("Expected QueueName %s but got %s", "my-queue", cli.QueueName)
+	}
+}
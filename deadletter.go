@@ -0,0 +1,16 @@
+package queue
+
+// Name of the dead-letter sub-queue of a queue or subscription.
+const deadLetterQueueName = "$DeadLetterQueue"
+
+// Returns a client receiving from the dead-letter sub-queue of the queue.
+// Messages received from it have DeadLetterReason and DeadLetterErrorDescription set.
+//
+// The service moves messages there once they were delivered more than the MaxDeliveryCount of the queue,
+// or when they expire on a queue with DeadLetteringOnMessageExpiration. The REST API has no operation
+// to dead-letter a message explicitly, that requires AMQP.
+//
+// For more information see https://docs.microsoft.com/en-us/azure/service-bus-messaging/service-bus-dead-letter-queues
+func (q *QueueClient) DeadLetterQueue() *QueueClient {
+	return q.withEntity(q.entity() + "/" + deadLetterQueueName)
+}
@@ -0,0 +1,43 @@
+package queue
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func Test_DeadLetterQueue(t *testing.T) {
+
+	var paths []string
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.Method+" "+req.URL.Path)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Deadletterreason":           []string{"\"reason\""},
+				"Deadlettererrordescription": []string{"\"description\""},
+			},
+			Body: ioutil.NopCloser(bytes.NewBufferString("")),
+		}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	msg, err := q.DeadLetterQueue().GetMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.DeadLetterReason != "reason" || msg.DeadLetterErrorDescription != "description" {
+		t.Fatalf("Expected DeadLetterReason and DeadLetterErrorDescription but got %s and %s", msg.DeadLetterReason, msg.DeadLetterErrorDescription)
+	}
+
+	if _, err := NewSubscriptionClient(&q, "my-topic", "my-sub").DeadLetterQueue().GetMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	comparePaths(t, []string{
+		"POST /test/$DeadLetterQueue/messages/head",
+		"POST /my-topic/subscriptions/my-sub/$DeadLetterQueue/messages/head",
+	}, paths)
+}
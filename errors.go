@@ -1,6 +1,118 @@
 package queue
 
-import "fmt"
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ServiceBusError is returned for error responses of the service.
+// It wraps the error type of the status code, e.g. BadRequestError,
+// so that errors.As matches both:
+//
+//	var sbErr *ServiceBusError
+//	if errors.As(err, &sbErr) { log.Println(sbErr.TrackingId) }
+//
+//	if errors.As(err, &MessageDontExistError{}) { ... }
+type ServiceBusError struct {
+	// HTTP status code of the response.
+	StatusCode int
+
+	// Code and Detail of the XML error body, empty if the body isn't an error document.
+	Code   string
+	Detail string
+
+	// Id of the request in the service logs, to quote to Azure support.
+	TrackingId string
+
+	// Delay requested by the Retry-After header, zero if none.
+	RetryAfter time.Duration
+
+	// Operation that failed, e.g. SendMessage.
+	Operation string
+
+	// Error of the status code.
+	Err error
+}
+
+func (e *ServiceBusError) Error() string {
+	msg := e.Err.Error()
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+
+	if e.Operation != "" {
+		msg = e.Operation + ": " + msg
+	}
+
+	return msg
+}
+
+func (e *ServiceBusError) Unwrap() error {
+	return e.Err
+}
+
+var trackingIdPattern = regexp.MustCompile(`TrackingId:([^,\s]+)`)
+
+// Creates the error of a response with a status code other than 200 and 201.
+//
+// See https://docs.microsoft.com/en-us/rest/api/servicebus/service-bus-runtime-rest#response-codes
+func newServiceBusError(resp *http.Response, body []byte, err error) *ServiceBusError {
+	e := &ServiceBusError{StatusCode: resp.StatusCode, Err: err}
+
+	var doc struct {
+		Code   string `xml:"Code"`
+		Detail string `xml:"Detail"`
+	}
+	if xml.Unmarshal(body, &doc) == nil {
+		e.Code = doc.Code
+		e.Detail = doc.Detail
+	}
+
+	if m := trackingIdPattern.FindStringSubmatch(e.Detail); m != nil {
+		e.TrackingId = m[1]
+	} else {
+		e.TrackingId = resp.Header.Get("x-ms-request-id")
+	}
+
+	e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+
+	return e
+}
+
+// Parses a Retry-After header, either seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
+
+// Returns the delay requested by the service with a failed response, zero if none.
+func retryAfter(err error) time.Duration {
+	var e *ServiceBusError
+	if errors.As(err, &e) {
+		return e.RetryAfter
+	}
+
+	return 0
+}
 
 type NoMessagesAvailableError struct {
 	Code int
@@ -56,10 +168,157 @@ func (e InternalError) Error() string {
 	return "Internal Error"
 }
 
+// Quota of the namespace or entity exceeded, e.g. the maximum queue size or number of connections.
+type QuotaExceededError struct {
+	Code int
+	Body string
+}
+
+func (e QuotaExceededError) Error() string {
+	return "Quota exceeded"
+}
+
+// Entity already exists, or a conflicting operation is in progress on it.
+type ConflictError struct {
+	Code int
+	Body string
+}
+
+func (e ConflictError) Error() string {
+	return "Conflicting operation or entity already exists"
+}
+
+// Message or batch larger than the maximum size of the namespace.
+type EntityTooLargeError struct {
+	Code int
+	Body string
+}
+
+func (e EntityTooLargeError) Error() string {
+	return "Request entity too large"
+}
+
+// Too many requests, the client should back off.
+type ThrottledError struct {
+	Code int
+	Body string
+}
+
+func (e ThrottledError) Error() string {
+	return "Request throttled"
+}
+
+// Service temporarily unable to process the request.
+type ServerBusyError struct {
+	Code int
+	Body string
+}
+
+func (e ServerBusyError) Error() string {
+	return "Server busy"
+}
+
+// Reports whether err is a transient failure worth retrying: an internal error, throttling,
+// a busy server, a dropped connection or a timeout.
+func IsTransient(err error) bool {
+
+	if errors.As(err, &InternalError{}) || IsThrottled(err) {
+		return true
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Reports whether the service asked the client to back off, with a ThrottledError or a ServerBusyError.
+func IsThrottled(err error) bool {
+	return errors.As(err, &ThrottledError{}) || errors.As(err, &ServerBusyError{})
+}
+
+// Reports whether err is a QuotaExceededError.
+func IsQuotaExceeded(err error) bool {
+	return errors.As(err, &QuotaExceededError{})
+}
+
+// Lock of a message expired or was lost before the message was settled, so it may be delivered again.
+// Err is the error of the service if it rejected the lock, nil if the lock had expired before sending.
+type LockLostError struct {
+	Id             string
+	LockToken      string
+	LockedUntilUtc time.Time
+	Err            error
+}
+
+func (e LockLostError) Error() string {
+	if e.LockedUntilUtc.IsZero() {
+		return fmt.Sprintf("Lock of message %s was lost", e.Id)
+	}
+	return fmt.Sprintf("Lock of message %s expired at %s", e.Id, e.LockedUntilUtc.Format(time.RFC3339))
+}
+
+func (e LockLostError) Unwrap() error {
+	return e.Err
+}
+
+// A batch of SendBatch failed after the batches before it sent the first Sent messages.
+// The outcome of the failed batch is unknown: after a 5xx or transport error it may have been enqueued,
+// so sending msgs[Sent:] again can duplicate its messages unless they have a MessageId
+// and the queue has duplicate detection enabled.
+type SendBatchError struct {
+	Sent int
+	Err  error
+}
+
+func (e SendBatchError) Error() string {
+	return fmt.Sprintf("Batch send failed after %d messages were sent: %v", e.Sent, e.Err)
+}
+
+func (e SendBatchError) Unwrap() error {
+	return e.Err
+}
+
+// Missing or malformed key of a connection string.
+type ConnectionStringError struct {
+	Key    string
+	Reason string
+}
+
+func (e ConnectionStringError) Error() string {
+	return fmt.Sprintf("Invalid connection string key %s: %s", e.Key, e.Reason)
+}
+
+// Content type of a message that doesn't match the codec decoding it, or has no codec registered.
+type ContentTypeError struct {
+	Expected string
+	Actual   string
+}
+
+func (e ContentTypeError) Error() string {
+	if e.Expected == "" {
+		return fmt.Sprintf("No codec registered for content type %q", e.Actual)
+	}
+	return fmt.Sprintf("Expected content type %q but got %q", e.Expected, e.Actual)
+}
+
+// Status code handleStatusCode has no dedicated error type for.
+type unknownStatusError struct {
+	Code int
+	Body string
+}
+
+func (e unknownStatusError) Error() string {
+	return fmt.Sprintf("Unknown status %v with body %v", e.Code, e.Body)
+}
+
 func wrap(err error, message string) error {
 	if err == nil {
 		return nil
 	}
 
-	return fmt.Errorf(message + ": " + err.Error())
+	return fmt.Errorf("%s: %w", message, err)
 }
\ No newline at end of file
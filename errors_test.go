@@ -0,0 +1,156 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_ServiceBusError(t *testing.T) {
+
+	body := `<Error><Code>400</Code><Detail>The request is invalid. TrackingId:7c8c1b4e-4b6a-4c8f-a0b2-5c4cf1b0b8f5_G12,SystemTracker:test:Queue:test,Timestamp:2018-02-21T21:03:56</Detail></Error>`
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusBadRequest,
+			Header:     http.Header{"Retry-After": []string{"3"}},
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+		}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	err := q.SendMessage(NewMessage([]byte("hello")))
+
+	var sbErr *ServiceBusError
+	if !errors.As(err, &sbErr) {
+		t.Fatalf("Expected %T but got %v", sbErr, err)
+	}
+
+	expected := ServiceBusError{
+		StatusCode: http.StatusBadRequest,
+		Code:       "400",
+		Detail:     "The request is invalid. TrackingId:7c8c1b4e-4b6a-4c8f-a0b2-5c4cf1b0b8f5_G12,SystemTracker:test:Queue:test,Timestamp:2018-02-21T21:03:56",
+		TrackingId: "7c8c1b4e-4b6a-4c8f-a0b2-5c4cf1b0b8f5_G12",
+		RetryAfter: 3 * time.Second,
+		Operation:  "SendMessage",
+		Err:        BadRequestError{400, body},
+	}
+
+	if *sbErr != expected {
+		t.Fatalf("Expected %+v but got %+v", expected, *sbErr)
+	}
+
+	var badRequest BadRequestError
+	if !errors.As(err, &badRequest) || badRequest.Body != body {
+		t.Fatalf("Expected BadRequestError with body but got %v", err)
+	}
+
+	if err.Error() != "SendMessage: Bad createRequest: "+expected.Detail {
+		t.Fatalf("Unexpected error message %s", err.Error())
+	}
+}
+
+func Test_ServiceBusError_Error(t *testing.T) {
+
+	err := &ServiceBusError{Err: MessageDontExistError{}}
+	if err.Error() != (MessageDontExistError{}).Error() {
+		t.Fatalf("Expected message of the wrapped error but got %s", err.Error())
+	}
+}
+
+func Test_wrap(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, syscall.ECONNRESET
+	}))
+	defer SetHttpClient(nil)
+
+	if err := q.DeleteMessage(&testMsg); !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("Expected transport error to be unwrappable but got %v", err)
+	}
+}
+
+func Test_parseRetryAfter(t *testing.T) {
+
+	now := time.Date(2018, 2, 21, 21, 3, 56, 0, time.UTC)
+
+	tests := map[string]time.Duration{
+		"":                              0,
+		"5":                             5 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Wed, 21 Feb 2018 21:04:06 GMT": 10 * time.Second,
+		"Wed, 21 Feb 2018 21:03:46 GMT": 0,
+	}
+
+	for value, expected := range tests {
+		if d := parseRetryAfter(value, now); d != expected {
+			t.Fatalf("Expected Retry-After %q to be %v but got %v", value, expected, d)
+		}
+	}
+}
+
+func Test_RetryPolicy_retryAfter(t *testing.T) {
+
+	attempts := 0
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts == 1 {
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Header:     http.Header{"Retry-After": []string{"1"}},
+				Body:       ioutil.NopCloser(bytes.NewBufferString("")),
+			}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	cli := QueueClient{Namespace: "test", QueueName: "test", RetryPolicy: testRetryPolicy}
+
+	start := time.Now()
+	if err := cli.DeleteMessage(&testMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("Expected retry to wait for Retry-After but it waited %v", elapsed)
+	}
+}
+
+func Test_classification(t *testing.T) {
+
+	tests := []struct {
+		err           error
+		transient     bool
+		throttled     bool
+		quotaExceeded bool
+	}{
+		{&ServiceBusError{Err: ThrottledError{429, ""}}, true, true, false},
+		{&ServiceBusError{Err: ServerBusyError{503, ""}}, true, true, false},
+		{&ServiceBusError{Err: InternalError{500, ""}}, true, false, false},
+		{&ServiceBusError{Err: QuotaExceededError{403, ""}}, false, false, true},
+		{&ServiceBusError{Err: ConflictError{409, ""}}, false, false, false},
+		{&ServiceBusError{Err: EntityTooLargeError{413, ""}}, false, false, false},
+		{wrap(syscall.ECONNRESET, "Sending POST createRequest failed"), true, false, false},
+		{errors.New("other"), false, false, false},
+	}
+
+	for _, test := range tests {
+		if IsTransient(test.err) != test.transient {
+			t.Fatalf("Expected IsTransient(%v) to be %v", test.err, test.transient)
+		}
+
+		if IsThrottled(test.err) != test.throttled {
+			t.Fatalf("Expected IsThrottled(%v) to be %v", test.err, test.throttled)
+		}
+
+		if IsQuotaExceeded(test.err) != test.quotaExceeded {
+			t.Fatalf("Expected IsQuotaExceeded(%v) to be %v", test.err, test.quotaExceeded)
+		}
+	}
+}
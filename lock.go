@@ -0,0 +1,159 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Shortest delay between two lock renewals.
+const minRenewInterval = time.Second
+
+// Keeps msg locked in the background by renewing its lock halfway before LockedUntilUtc
+// until stop is called, ctx is done or maxDuration elapses. A maxDuration of zero or less means no limit.
+//
+// The renewer works on its own copy of the message, msg.LockedUntilUtc is updated when stop returns.
+// Meanwhile LockExpired, TimeUntilLockExpiry and the settle operations of msg see the renewed lock.
+// Call stop once the message is handled, before deleting or unlocking it.
+func (q *QueueClient) AutoRenewLock(ctx context.Context, msg *Message, maxDuration time.Duration) (stop func()) {
+
+	var cancel context.CancelFunc
+	if maxDuration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, maxDuration)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	msg.renewed = &lockExpiry{until: msg.lockedUntil()}
+	locked := *msg
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for {
+			timer := time.NewTimer(renewInterval(locked.LockedUntilUtc))
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if err := q.RenewLockContext(ctx, &locked); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				q.log().Error("Lock renewal failed", "message_id", locked.Id, "error", err)
+
+				// the lock is gone, there's nothing left to renew
+				if errors.As(err, &LockLostError{}) || errors.As(err, &MessageDontExistError{}) {
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-done
+			msg.LockedUntilUtc = msg.lockedUntil()
+		})
+	}
+}
+
+// Lock expiry of a message, extended by its renewer while the message is handled in another goroutine.
+type lockExpiry struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (e *lockExpiry) get() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.until
+}
+
+func (e *lockExpiry) extend(until time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if until.After(e.until) {
+		e.until = until
+	}
+}
+
+// Returns the time the lock of m expires, including renewals by AutoRenewLock that m.LockedUntilUtc
+// doesn't reflect yet.
+func (m *Message) lockedUntil() time.Time {
+	if m.renewed != nil {
+		if until := m.renewed.get(); until.After(m.LockedUntilUtc) {
+			return until
+		}
+	}
+
+	return m.LockedUntilUtc
+}
+
+// Returns the delay before the next renewal of a lock held until lockedUntil.
+func renewInterval(lockedUntil time.Time) time.Duration {
+	wait := time.Until(lockedUntil) / 2
+
+	if wait < minRenewInterval {
+		return minRenewInterval
+	}
+
+	return wait
+}
+
+// Reports whether the lock of a received message has expired, as per the local clock.
+// Messages received without a lock, e.g. with ReceiveAndDelete, never expire.
+func (m *Message) LockExpired() bool {
+	until := m.lockedUntil()
+	return !until.IsZero() && !time.Now().Before(until)
+}
+
+// Returns the time left until the lock of a received message expires, zero if it has expired
+// or the message has no lock.
+func (m *Message) TimeUntilLockExpiry() time.Duration {
+	until := m.lockedUntil()
+	if d := time.Until(until); d > 0 && !until.IsZero() {
+		return d
+	}
+
+	return 0
+}
+
+// Returns a LockLostError if the lock of msg has expired, so that a settle operation fails without a request.
+func checkLock(msg *Message) error {
+	if msg.LockExpired() {
+		return LockLostError{Id: msg.Id, LockToken: msg.LockToken, LockedUntilUtc: msg.lockedUntil()}
+	}
+
+	return nil
+}
+
+// Reports the 404 Not Found of a settle operation as a LockLostError if the lock of msg has expired
+// meanwhile or the service rejected the lock, rather than the message id.
+func lockError(msg *Message, err error) error {
+	var sbErr *ServiceBusError
+	var missing MessageDontExistError
+	if !errors.As(err, &sbErr) || !errors.As(sbErr.Err, &missing) {
+		return err
+	}
+
+	// e.g. "The lock supplied is invalid. Either the lock expired, or the message has already been removed from the queue."
+	body := strings.ToLower(missing.Body)
+	rejected := strings.Contains(body, "lock") && (strings.Contains(body, "expired") || strings.Contains(body, "invalid"))
+
+	if msg.LockExpired() || rejected {
+		sbErr.Err = LockLostError{msg.Id, msg.LockToken, msg.lockedUntil(), missing}
+	}
+
+	return err
+}
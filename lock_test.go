@@ -0,0 +1,233 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_RenewLock(t *testing.T) {
+
+	lockedUntil := time.Date(2018, 1, 1, 1, 1, 1, 0, time.UTC)
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != "POST" || !strings.HasSuffix(req.URL.Path, "/messages/1/token") {
+			t.Fatalf("Unexpected request %s %s", req.Method, req.URL.Path)
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Brokerproperties": []string{`{"LockedUntilUtc":"` + lockedUntil.Format(Rfc2616Time) + `"}`}},
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	msg := &Message{Id: "1", LockToken: "token"}
+
+	if err := q.RenewLock(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if !msg.LockedUntilUtc.Equal(lockedUntil) {
+		t.Fatalf("Expected LockedUntilUtc %s but got %s", lockedUntil, msg.LockedUntilUtc)
+	}
+}
+
+func Test_RenewLock_lockDuration(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	cli := QueueClient{Namespace: "test", QueueName: "test", LockDuration: time.Minute}
+	msg := &Message{Id: "1", LockToken: "token"}
+
+	before := time.Now()
+	if err := cli.RenewLock(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.LockedUntilUtc.Before(before.Add(time.Minute)) || msg.LockedUntilUtc.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("Expected LockedUntilUtc a minute from now but got %s", msg.LockedUntilUtc)
+	}
+}
+
+func Test_AutoRenewLock(t *testing.T) {
+
+	var renewals int32
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&renewals, 1)
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	cli := QueueClient{Namespace: "test", QueueName: "test", LockDuration: time.Second}
+	msg := &Message{Id: "1", LockToken: "token", LockedUntilUtc: time.Now().Add(2 * time.Second)}
+
+	stop := cli.AutoRenewLock(context.Background(), msg, 0)
+	time.Sleep(1500 * time.Millisecond)
+	stop()
+	stop()
+
+	if n := atomic.LoadInt32(&renewals); n != 1 {
+		t.Fatalf("Expected 1 renewal but got %d", n)
+	}
+
+	if time.Until(msg.LockedUntilUtc) <= 0 {
+		t.Fatalf("Expected LockedUntilUtc to be extended but got %s", msg.LockedUntilUtc)
+	}
+}
+
+func Test_AutoRenewLock_settle(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	cli := QueueClient{Namespace: "test", QueueName: "test", LockDuration: 2 * time.Second}
+	msg := &Message{Id: "1", LockToken: "token", LockedUntilUtc: time.Now().Add(2 * time.Second)}
+
+	stop := cli.AutoRenewLock(context.Background(), msg, 0)
+	defer stop()
+
+	// handled for longer than the initial lock, the renewed lock must be seen before stop is called
+	time.Sleep(2500 * time.Millisecond)
+
+	if msg.LockExpired() {
+		t.Fatal("Expected the renewed lock not to be expired")
+	}
+
+	if msg.TimeUntilLockExpiry() <= 0 {
+		t.Fatal("Expected time until the renewed lock expires")
+	}
+
+	if err := cli.DeleteMessage(msg); err != nil {
+		t.Fatalf("Expected the message to be deleted but got %v", err)
+	}
+}
+
+func Test_AutoRenewLock_maxDuration(t *testing.T) {
+
+	var renewals int32
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&renewals, 1)
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	msg := &Message{Id: "1", LockToken: "token"}
+
+	stop := q.AutoRenewLock(context.Background(), msg, 100*time.Millisecond)
+	time.Sleep(1200 * time.Millisecond)
+	stop()
+
+	if n := atomic.LoadInt32(&renewals); n != 0 {
+		t.Fatalf("Expected no renewals after max duration but got %d", n)
+	}
+}
+
+func Test_renewInterval(t *testing.T) {
+
+	if d := renewInterval(time.Time{}); d != minRenewInterval {
+		t.Fatalf("Expected interval %s but got %s", minRenewInterval, d)
+	}
+
+	if d := renewInterval(time.Now().Add(time.Minute)); d < 29*time.Second || d > 30*time.Second {
+		t.Fatalf("Expected interval of about 30s but got %s", d)
+	}
+}
+
+func Test_LockExpired(t *testing.T) {
+
+	if msg := (&Message{}); msg.LockExpired() || msg.TimeUntilLockExpiry() != 0 {
+		t.Fatal("Expected message without lock not to expire")
+	}
+
+	if msg := (&Message{LockedUntilUtc: time.Now().Add(-time.Second)}); !msg.LockExpired() || msg.TimeUntilLockExpiry() != 0 {
+		t.Fatal("Expected lock to be expired")
+	}
+
+	msg := &Message{LockedUntilUtc: time.Now().Add(time.Minute)}
+	if msg.LockExpired() {
+		t.Fatal("Expected lock not to be expired")
+	}
+
+	if d := msg.TimeUntilLockExpiry(); d < 59*time.Second || d > time.Minute {
+		t.Fatalf("Expected about a minute until lock expiry but got %s", d)
+	}
+}
+
+func Test_settle_lockExpired(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		t.Fatalf("Unexpected request %s %s", req.Method, req.URL.Path)
+		return nil, nil
+	}))
+	defer SetHttpClient(nil)
+
+	msg := &Message{Id: "1", LockToken: "token", LockedUntilUtc: time.Now().Add(-time.Second)}
+
+	settle := map[string]func() error{
+		"DeleteMessage": func() error { return q.DeleteMessage(msg) },
+		"UnlockMessage": func() error { return q.UnlockMessage(msg) },
+		"RenewLock":     func() error { return q.RenewLock(msg) },
+	}
+
+	for name, f := range settle {
+		var lost LockLostError
+		if err := f(); !errors.As(err, &lost) {
+			t.Fatalf("%s: Expected %T but got %v", name, LockLostError{}, err)
+		}
+
+		if lost.Id != "1" || lost.LockToken != "token" || !lost.LockedUntilUtc.Equal(msg.LockedUntilUtc) || lost.Err != nil {
+			t.Fatalf("%s: Unexpected %#v", name, lost)
+		}
+	}
+}
+
+func Test_settle_lockLost(t *testing.T) {
+
+	body := "The lock supplied is invalid. Either the lock expired, or the message has already been removed from the queue."
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	err := q.DeleteMessage(&Message{Id: "1", LockToken: "token"})
+
+	if !errors.As(err, &LockLostError{}) {
+		t.Fatalf("Expected %T but got %v", LockLostError{}, err)
+	}
+
+	if !errors.As(err, &MessageDontExistError{}) {
+		t.Fatalf("Expected %T but got %v", MessageDontExistError{}, err)
+	}
+
+	var sbErr *ServiceBusError
+	if !errors.As(err, &sbErr) || sbErr.StatusCode != http.StatusNotFound || sbErr.Operation != "DeleteMessage" {
+		t.Fatalf("Expected ServiceBusError for DeleteMessage but got %v", err)
+	}
+}
+
+func Test_settle_messageDontExist(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(strings.NewReader("No message was found"))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	err := q.DeleteMessage(&Message{Id: "1", LockToken: "token", LockedUntilUtc: time.Now().Add(time.Minute)})
+
+	if errors.As(err, &LockLostError{}) || !errors.As(err, &MessageDontExistError{}) {
+		t.Fatalf("Expected %T but got %v", MessageDontExistError{}, err)
+	}
+}
@@ -1,27 +1,78 @@
 package queue
 
-import "log"
+import (
+	"fmt"
+	"log"
+	"strings"
+)
 
 type Log func(...interface{})
 
+// Logger receives leveled records with structured fields as alternating keys and values,
+// e.g. queue, operation, message_id, status_code and latency. *slog.Logger satisfies it.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
 type internalLogger struct {
 	logDebug Log
 	logError Log
+
+	// Receives the records instead of logDebug and logError if set.
+	structured Logger
+
+	// Fields added to every record, e.g. the queue of the client.
+	fields []interface{}
 }
 
-func (l internalLogger) Debug(v ...interface{}) {
-	if l.logDebug != nil {
-		l.logDebug(v)
+func (l internalLogger) Debug(msg string, args ...interface{}) {
+	if l.structured != nil {
+		l.structured.Debug(msg, l.args(args)...)
+	} else if l.logDebug != nil {
+		l.logDebug(formatRecord(msg, l.args(args)))
 	}
 }
 
-func (l internalLogger) Error(v ...interface{}) {
-	if l.logError != nil {
-		l.logError(v)
+func (l internalLogger) Error(msg string, args ...interface{}) {
+	if l.structured != nil {
+		l.structured.Error(msg, l.args(args)...)
+	} else if l.logError != nil {
+		l.logError(formatRecord(msg, l.args(args)))
 	}
 }
 
-var logger internalLogger = internalLogger{log.Print, log.Print}
+// Returns a logger adding the key-value pairs args to every record.
+func (l internalLogger) with(args ...interface{}) internalLogger {
+	l.fields = append(l.fields[:len(l.fields):len(l.fields)], args...)
+	return l
+}
+
+func (l internalLogger) args(args []interface{}) []interface{} {
+	if len(l.fields) == 0 {
+		return args
+	}
+
+	return append(l.fields[:len(l.fields):len(l.fields)], args...)
+}
+
+// Formats a record for a Log function as the message followed by key=value pairs.
+func formatRecord(msg string, args []interface{}) string {
+	var b strings.Builder
+	b.WriteString(msg)
+
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i])
+		}
+	}
+
+	return b.String()
+}
+
+var logger internalLogger = internalLogger{logDebug: log.Print, logError: log.Print}
 
 // Sets the package's debug logger. Pass nil to disable debug logging.
 func SetDebugLogger(log Log) {
@@ -1,6 +1,9 @@
 package queue
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 func Test_internalLogger(t *testing.T) {
 
@@ -44,4 +47,16 @@ func Test_internalLogger(t *testing.T) {
 	if errorOutput != false {
 		t.Fatalf("Expected custom error function to be reset")
 	}
-}
\ No newline at end of file
+}
+
+func Test_internalLogger_fields(t *testing.T) {
+
+	var output []interface{}
+	l := internalLogger{logDebug: func(v ...interface{}) { output = v }}.with("queue", "orders")
+
+	l.Debug("Response", "status_code", 200, "odd")
+
+	if len(output) != 1 || fmt.Sprint(output...) != "Response queue=orders status_code=200 odd" {
+		t.Fatalf("Unexpected output %#v", output)
+	}
+}
@@ -0,0 +1,401 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	managementAPIVersion = "2017-04"
+
+	contentTypeAtomEntry = "application/atom+xml;type=entry;charset=utf-8"
+
+	// Number of queues requested per page when listing queues.
+	listPageSize = 100
+)
+
+// Settings of a queue. Zero values are left to the service defaults when creating a queue.
+//
+// For more information see https://docs.microsoft.com/en-us/rest/api/servicebus/queues
+type QueueDescription struct {
+	// Name of the queue, its path relative to the namespace.
+	Name string
+
+	// Duration a received message is locked for other receivers, at most 5 minutes.
+	LockDuration time.Duration
+
+	// Number of deliveries after which a message is dead-lettered.
+	MaxDeliveryCount int
+
+	// Messages must have a SessionId. Receiving from such queues requires AMQP, the REST API can't accept sessions.
+	// Can't be changed once the queue is created.
+	RequiresSession bool
+
+	// Time to live of messages that don't set TimeToLive.
+	DefaultMessageTimeToLive time.Duration
+
+	// Expired messages are moved to the dead-letter queue rather than dropped.
+	DeadLetteringOnMessageExpiration bool
+
+	// Messages with the MessageId of a message sent within DuplicateDetectionHistoryTimeWindow are dropped.
+	// Can't be changed once the queue is created.
+	RequiresDuplicateDetection bool
+
+	// Duration message ids are remembered for duplicate detection.
+	DuplicateDetectionHistoryTimeWindow time.Duration
+}
+
+// ManagementClient creates, updates, deletes and lists the queues of a namespace
+// through the Atom/XML entity endpoints.
+// Requests must be authorized with a policy with the Manage right.
+type ManagementClient struct {
+	q *QueueClient
+}
+
+// Creates a management client for the namespace of c, using its endpoint, credentials,
+// http client and retry policy. The QueueName of c is ignored.
+func NewManagementClient(c *QueueClient) *ManagementClient {
+	return &ManagementClient{q: c.withEntity("")}
+}
+
+// Creates a queue and returns its description with the defaults applied by the service.
+func (m *ManagementClient) CreateQueue(ctx context.Context, desc *QueueDescription) (*QueueDescription, error) {
+
+	// a retried create could fail with a conflict on the queue created by the first attempt
+	return m.putQueue(ctx, desc, false)
+}
+
+// Updates the settings of an existing queue, a QueueDontExistError is returned if it doesn't exist.
+// All settings are replaced, so desc should be based on the result of GetQueue.
+func (m *ManagementClient) UpdateQueue(ctx context.Context, desc *QueueDescription) (*QueueDescription, error) {
+	return m.putQueue(ctx, desc, true)
+}
+
+func (m *ManagementClient) putQueue(ctx context.Context, desc *QueueDescription, update bool) (*QueueDescription, error) {
+
+	body, err := xml.Marshal(&atomEntry{
+		Title:   desc.Name,
+		Content: &atomContent{Type: "application/xml", QueueDescription: newQueueDescriptionXML(desc)},
+	})
+	if err != nil {
+		return nil, wrap(err, "QueueDescription encode failed")
+	}
+
+	operation := "CreateQueue"
+	if update {
+		operation = "UpdateQueue"
+	}
+
+	resp, err := m.q.do(ctx, operation, update, func() (*http.Request, error) {
+		req, err := m.createRequest(ctx, desc.Name, "PUT", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set(headerContentType, contentTypeAtomEntry)
+		if update {
+			req.Header.Set("If-Match", "*")
+		}
+
+		return req, nil
+	})
+
+	if err != nil {
+		return nil, queueError(err)
+	}
+
+	defer resp.Body.Close()
+
+	return parseQueueEntry(resp.Body)
+}
+
+// Deletes a queue and all its messages, a QueueDontExistError is returned if it doesn't exist.
+func (m *ManagementClient) DeleteQueue(ctx context.Context, name string) error {
+	resp, err := m.q.do(ctx, "DeleteQueue", true, func() (*http.Request, error) {
+		return m.createRequest(ctx, name, "DELETE", nil)
+	})
+
+	if err != nil {
+		return queueError(err)
+	}
+
+	return resp.Body.Close()
+}
+
+// Returns the description of a queue, a QueueDontExistError is returned if it doesn't exist.
+func (m *ManagementClient) GetQueue(ctx context.Context, name string) (*QueueDescription, error) {
+	resp, err := m.q.do(ctx, "GetQueue", true, func() (*http.Request, error) {
+		return m.createRequest(ctx, name, "GET", nil)
+	})
+
+	if err != nil {
+		return nil, queueError(err)
+	}
+
+	defer resp.Body.Close()
+
+	return parseQueueEntry(resp.Body)
+}
+
+// Returns the descriptions of all queues of the namespace.
+func (m *ManagementClient) ListQueues(ctx context.Context) ([]*QueueDescription, error) {
+
+	var queues []*QueueDescription
+
+	for skip := 0; ; skip += listPageSize {
+		page, err := m.listQueues(ctx, skip, listPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		queues = append(queues, page...)
+
+		if len(page) < listPageSize {
+			return queues, nil
+		}
+	}
+}
+
+func (m *ManagementClient) listQueues(ctx context.Context, skip int, top int) ([]*QueueDescription, error) {
+	resp, err := m.q.do(ctx, "ListQueues", true, func() (*http.Request, error) {
+		return m.createRequest(ctx, "$Resources/Queues?$skip="+strconv.Itoa(skip)+"&$top="+strconv.Itoa(top), "GET", nil)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	feed := atomFeed{}
+	if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, wrap(err, "Error reading queue list")
+	}
+
+	var queues []*QueueDescription
+	for _, e := range feed.Entries {
+		if e.Content != nil && e.Content.QueueDescription != nil {
+			queues = append(queues, e.Content.QueueDescription.toQueueDescription(e.Title))
+		}
+	}
+
+	return queues, nil
+}
+
+// Creates a request to a path relative to the namespace, authorized for the whole namespace.
+func (m *ManagementClient) createRequest(ctx context.Context, path string, method string, body io.Reader) (*http.Request, error) {
+	audience := m.q.baseURL() + "/"
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, audience+path+separator+"api-version="+managementAPIVersion, body)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := m.q.getTokenProvider().Token(ctx, audience)
+	if err != nil {
+		return nil, wrap(err, "Token request failed")
+	}
+
+	req.Header.Set("Authorization", token.Value)
+	return req, nil
+}
+
+// Entity endpoints report a missing queue with 404 Not Found, rather than 410 Gone like the messaging endpoints.
+func queueError(err error) error {
+	var sbErr *ServiceBusError
+	var missing MessageDontExistError
+	if errors.As(err, &sbErr) && errors.As(sbErr.Err, &missing) {
+		sbErr.Err = QueueDontExistError{missing.Code, missing.Body}
+	}
+
+	return err
+}
+
+// Parses an Atom entry with a QueueDescription.
+func parseQueueEntry(r io.Reader) (*QueueDescription, error) {
+
+	entry := atomEntry{}
+	if err := readEntry(r, &entry); err != nil {
+		return nil, err
+	}
+
+	if entry.Content == nil || entry.Content.QueueDescription == nil {
+		return nil, QueueDontExistError{Code: http.StatusNotFound}
+	}
+
+	return entry.Content.QueueDescription.toQueueDescription(entry.Title), nil
+}
+
+// Reads an Atom entry into v.
+// Getting a queue that doesn't exist returns an empty feed instead of an entry.
+func readEntry(r io.Reader, v interface{}) error {
+
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return wrap(err, "Error reading queue description")
+	}
+
+	if err := xml.Unmarshal(body, v); err != nil {
+		feed := atomFeed{}
+		if xml.Unmarshal(body, &feed) == nil && len(feed.Entries) == 0 {
+			return QueueDontExistError{http.StatusNotFound, string(body)}
+		}
+		return wrap(err, "Error reading queue description")
+	}
+
+	return nil
+}
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom entry"`
+	Title   string       `xml:"title"`
+	Content *atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type             string               `xml:"type,attr"`
+	QueueDescription *queueDescriptionXML `xml:"http://schemas.microsoft.com/netservices/2010/10/servicebus/connect QueueDescription"`
+}
+
+// The service expects the elements of a QueueDescription in this order.
+type queueDescriptionXML struct {
+	LockDuration                        string `xml:"LockDuration,omitempty"`
+	RequiresDuplicateDetection          bool   `xml:"RequiresDuplicateDetection"`
+	RequiresSession                     bool   `xml:"RequiresSession"`
+	DefaultMessageTimeToLive            string `xml:"DefaultMessageTimeToLive,omitempty"`
+	DeadLetteringOnMessageExpiration    bool   `xml:"DeadLetteringOnMessageExpiration"`
+	DuplicateDetectionHistoryTimeWindow string `xml:"DuplicateDetectionHistoryTimeWindow,omitempty"`
+	MaxDeliveryCount                    int    `xml:"MaxDeliveryCount,omitempty"`
+}
+
+func newQueueDescriptionXML(d *QueueDescription) *queueDescriptionXML {
+	x := &queueDescriptionXML{
+		RequiresDuplicateDetection:       d.RequiresDuplicateDetection,
+		RequiresSession:                  d.RequiresSession,
+		DeadLetteringOnMessageExpiration: d.DeadLetteringOnMessageExpiration,
+		MaxDeliveryCount:                 d.MaxDeliveryCount,
+	}
+
+	if d.LockDuration > 0 {
+		x.LockDuration = formatDuration(d.LockDuration)
+	}
+
+	if d.DefaultMessageTimeToLive > 0 {
+		x.DefaultMessageTimeToLive = formatDuration(d.DefaultMessageTimeToLive)
+	}
+
+	if d.DuplicateDetectionHistoryTimeWindow > 0 {
+		x.DuplicateDetectionHistoryTimeWindow = formatDuration(d.DuplicateDetectionHistoryTimeWindow)
+	}
+
+	return x
+}
+
+func (x *queueDescriptionXML) toQueueDescription(name string) *QueueDescription {
+	d := &QueueDescription{
+		Name:                             name,
+		RequiresDuplicateDetection:       x.RequiresDuplicateDetection,
+		RequiresSession:                  x.RequiresSession,
+		DeadLetteringOnMessageExpiration: x.DeadLetteringOnMessageExpiration,
+		MaxDeliveryCount:                 x.MaxDeliveryCount,
+	}
+
+	d.LockDuration, _ = parseDuration(x.LockDuration)
+	d.DefaultMessageTimeToLive, _ = parseDuration(x.DefaultMessageTimeToLive)
+	d.DuplicateDetectionHistoryTimeWindow, _ = parseDuration(x.DuplicateDetectionHistoryTimeWindow)
+
+	return d
+}
+
+// Formats a duration in the ISO 8601 format of the service, e.g. PT1M or P14DT12H.
+func formatDuration(d time.Duration) string {
+
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+
+	s := "P"
+	if days > 0 {
+		s += strconv.FormatInt(int64(days), 10) + "D"
+	}
+
+	if hours == 0 && minutes == 0 && d == 0 {
+		if days == 0 {
+			return "PT0S"
+		}
+		return s
+	}
+
+	s += "T"
+	if hours > 0 {
+		s += strconv.FormatInt(int64(hours), 10) + "H"
+	}
+	if minutes > 0 {
+		s += strconv.FormatInt(int64(minutes), 10) + "M"
+	}
+	if d > 0 {
+		s += strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "S"
+	}
+
+	return s
+}
+
+var durationPattern = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// Parses an ISO 8601 duration with days, hours, minutes and seconds.
+// Durations longer than time.Duration can hold, like the default time to live of the service
+// P10675199DT2H48M5.4775807S, are capped to the maximum duration. An empty string is a zero duration.
+func parseDuration(s string) (time.Duration, error) {
+
+	if s == "" {
+		return 0, nil
+	}
+
+	parts := durationPattern.FindStringSubmatch(s)
+	if parts == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("Invalid ISO 8601 duration %s", s)
+	}
+
+	var seconds float64
+	for i, unit := range []float64{24 * 60 * 60, 60 * 60, 60, 1} {
+		if parts[i+1] == "" {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(parts[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid ISO 8601 duration %s", s)
+		}
+		seconds += v * unit
+	}
+
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		return time.Duration(math.MaxInt64), nil
+	}
+
+	return time.Duration(math.Round(seconds * float64(time.Second))), nil
+}
@@ -0,0 +1,225 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const queueEntry = `<entry xmlns="http://www.w3.org/2005/Atom">
+	<id>https://test.servicebus.windows.net/orders?api-version=2017-04</id>
+	<title type="text">orders</title>
+	<content type="application/xml">
+		<QueueDescription xmlns="http://schemas.microsoft.com/netservices/2010/10/servicebus/connect" xmlns:i="http://www.w3.org/2001/XMLSchema-instance">
+			<LockDuration>PT1M</LockDuration>
+			<MaxSizeInMegabytes>1024</MaxSizeInMegabytes>
+			<RequiresDuplicateDetection>true</RequiresDuplicateDetection>
+			<RequiresSession>true</RequiresSession>
+			<DefaultMessageTimeToLive>P10675199DT2H48M5.4775807S</DefaultMessageTimeToLive>
+			<DeadLetteringOnMessageExpiration>true</DeadLetteringOnMessageExpiration>
+			<DuplicateDetectionHistoryTimeWindow>PT10M</DuplicateDetectionHistoryTimeWindow>
+			<MaxDeliveryCount>10</MaxDeliveryCount>
+		</QueueDescription>
+	</content>
+</entry>`
+
+func Test_ManagementClient_CreateQueue(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != "PUT" || req.URL.Path != "/orders" || req.URL.Query().Get("api-version") != managementAPIVersion {
+			t.Fatalf("Unexpected request %s %s", req.Method, req.URL)
+		}
+
+		if req.Header.Get("If-Match") != "" || req.Header.Get(headerContentType) != contentTypeAtomEntry {
+			t.Fatalf("Unexpected headers %v", req.Header)
+		}
+
+		body, _ := ioutil.ReadAll(req.Body)
+		for _, expected := range []string{
+			`<entry xmlns="http://www.w3.org/2005/Atom"><title>orders</title>`,
+			`<QueueDescription xmlns="http://schemas.microsoft.com/netservices/2010/10/servicebus/connect"><LockDuration>PT1M</LockDuration>`,
+			`<RequiresSession>true</RequiresSession><DefaultMessageTimeToLive>P14D</DefaultMessageTimeToLive>`,
+			`<MaxDeliveryCount>5</MaxDeliveryCount>`,
+		} {
+			if !strings.Contains(string(body), expected) {
+				t.Fatalf("Expected body to contain %s but got %s", expected, body)
+			}
+		}
+
+		return &http.Response{StatusCode: http.StatusCreated, Body: ioutil.NopCloser(bytes.NewBufferString(queueEntry))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	created, err := NewManagementClient(&q).CreateQueue(context.Background(), &QueueDescription{
+		Name:                     "orders",
+		LockDuration:             time.Minute,
+		MaxDeliveryCount:         5,
+		RequiresSession:          true,
+		DefaultMessageTimeToLive: 14 * 24 * time.Hour,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &QueueDescription{
+		Name:                                "orders",
+		LockDuration:                        time.Minute,
+		MaxDeliveryCount:                    10,
+		RequiresSession:                     true,
+		DefaultMessageTimeToLive:            time.Duration(math.MaxInt64),
+		DeadLetteringOnMessageExpiration:    true,
+		RequiresDuplicateDetection:          true,
+		DuplicateDetectionHistoryTimeWindow: 10 * time.Minute,
+	}
+
+	if !reflect.DeepEqual(created, expected) {
+		t.Fatalf("Expected %+v but got %+v", expected, created)
+	}
+}
+
+func Test_ManagementClient_UpdateQueue(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != "PUT" || req.Header.Get("If-Match") != "*" {
+			t.Fatalf("Expected update with If-Match * but got %s %v", req.Method, req.Header)
+		}
+
+		return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	_, err := NewManagementClient(&q).UpdateQueue(context.Background(), &QueueDescription{Name: "orders"})
+	if !errors.As(err, &QueueDontExistError{}) {
+		t.Fatalf("Expected %T but got %v", QueueDontExistError{}, err)
+	}
+}
+
+func Test_ManagementClient_GetQueue_missing(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		feed := `<feed xmlns="http://www.w3.org/2005/Atom"><title type="text">Publicly Listed Services</title></feed>`
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString(feed))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	_, err := NewManagementClient(&q).GetQueue(context.Background(), "orders")
+	if !errors.As(err, &QueueDontExistError{}) {
+		t.Fatalf("Expected %T but got %v", QueueDontExistError{}, err)
+	}
+}
+
+func Test_ManagementClient_ListQueues(t *testing.T) {
+
+	var queries []string
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/$Resources/Queues" {
+			t.Fatalf("Unexpected request %s %s", req.Method, req.URL.Path)
+		}
+
+		queries = append(queries, req.URL.Query().Get("$skip")+"/"+req.URL.Query().Get("$top"))
+
+		// a full first page and one queue on the second
+		n := listPageSize
+		if req.URL.Query().Get("$skip") != "0" {
+			n = 1
+		}
+
+		feed := `<feed xmlns="http://www.w3.org/2005/Atom">` + strings.Repeat(queueEntry, n) + `</feed>`
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString(feed))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	queues, err := NewManagementClient(&q).ListQueues(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queues) != listPageSize+1 || queues[0].Name != "orders" {
+		t.Fatalf("Expected %d queues but got %d", listPageSize+1, len(queues))
+	}
+
+	comparePaths(t, []string{"0/100", "100/100"}, queries)
+}
+
+func Test_ManagementClient_DeleteQueue(t *testing.T) {
+
+	var paths []string
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.Method+" "+req.URL.Path)
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	if err := NewManagementClient(&q).DeleteQueue(context.Background(), "orders"); err != nil {
+		t.Fatal(err)
+	}
+
+	comparePaths(t, []string{"DELETE /orders"}, paths)
+}
+
+func Test_formatDuration(t *testing.T) {
+
+	cases := map[time.Duration]string{
+		0:                                  "PT0S",
+		30 * time.Second:                   "PT30S",
+		time.Minute:                        "PT1M",
+		1500 * time.Millisecond:            "PT1.5S",
+		14 * 24 * time.Hour:                "P14D",
+		26*time.Hour + 3*time.Minute:       "P1DT2H3M",
+		2*time.Hour + 500*time.Millisecond: "PT2H0.5S",
+	}
+
+	for d, expected := range cases {
+		if s := formatDuration(d); s != expected {
+			t.Fatalf("Expected %v to be formatted as %s but got %s", d, expected, s)
+		}
+
+		if parsed, err := parseDuration(expected); err != nil || parsed != d {
+			t.Fatalf("Expected %s to be parsed as %v but got %v, %v", expected, d, parsed, err)
+		}
+	}
+}
+
+func Test_parseDuration(t *testing.T) {
+
+	if d, err := parseDuration("P10675199DT2H48M5.4775807S"); err != nil || d != time.Duration(math.MaxInt64) {
+		t.Fatalf("Expected maximum duration but got %v, %v", d, err)
+	}
+
+	for _, s := range []string{"P", "PT", "1M", "P1Y", "PT1.M", "PT-1S"} {
+		if _, err := parseDuration(s); err == nil {
+			t.Fatalf("Expected error parsing %s", s)
+		}
+	}
+}
+
+func Test_QueueDescription_elementOrder(t *testing.T) {
+
+	b, err := xml.Marshal(newQueueDescriptionXML(&QueueDescription{
+		LockDuration:                        time.Minute,
+		DuplicateDetectionHistoryTimeWindow: time.Minute,
+		MaxDeliveryCount:                    1,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := []string{"LockDuration", "RequiresDuplicateDetection", "RequiresSession", "DeadLetteringOnMessageExpiration", "DuplicateDetectionHistoryTimeWindow", "MaxDeliveryCount"}
+	last := -1
+	for _, element := range order {
+		i := strings.Index(string(b), "<"+element+">")
+		if i < last {
+			t.Fatalf("Expected %s in order %v but got %s", element, order, b)
+		}
+		last = i
+	}
+}
@@ -0,0 +1,89 @@
+package queue
+
+// Option configures a QueueClient created with NewQueueClient or NewQueueClientFromConnectionString.
+type Option func(q *QueueClient)
+
+// Creates a client for the queue in the namespace, configured by opts.
+// The client must not be modified once it's in use, the options are the only configuration it needs.
+//
+//	cli := queue.NewQueueClient("my-test", "my-queue",
+//		queue.WithSharedAccessKey("RootManageSharedAccessKey", "..."),
+//		queue.WithHttpClient(&http.Client{Transport: transport}),
+//		queue.WithRetryPolicy(queue.DefaultRetryPolicy()))
+func NewQueueClient(namespace string, queueName string, opts ...Option) *QueueClient {
+	return withOptions(&QueueClient{Namespace: namespace, QueueName: queueName}, opts)
+}
+
+func withOptions(q *QueueClient, opts []Option) *QueueClient {
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	return q
+}
+
+// Sets the name of the queue, e.g. for connection strings of the namespace without EntityPath.
+func WithQueueName(queueName string) Option {
+	return func(q *QueueClient) {
+		q.QueueName = queueName
+	}
+}
+
+// Sends the requests of the client, and of the topic, subscription and management clients derived from it,
+// with c instead of the package's http client.
+func WithHttpClient(c HttpClient) Option {
+	return func(q *QueueClient) {
+		q.httpClient = c
+	}
+}
+
+// Sets the base URL of the namespace, see QueueClient.Endpoint.
+func WithEndpoint(endpoint string) Option {
+	return func(q *QueueClient) {
+		q.Endpoint = endpoint
+	}
+}
+
+// Sets the request timeout in seconds, see QueueClient.Timeout.
+func WithTimeout(seconds int) Option {
+	return func(q *QueueClient) {
+		q.Timeout = seconds
+	}
+}
+
+// Signs requests with a Shared Access Signature token of the policy.
+func WithSharedAccessKey(keyName string, keyValue string) Option {
+	return func(q *QueueClient) {
+		q.KeyName = keyName
+		q.KeyValue = keyValue
+	}
+}
+
+// Authorizes requests with tokens of p, see QueueClient.TokenProvider.
+func WithTokenProvider(p TokenProvider) Option {
+	return func(q *QueueClient) {
+		q.TokenProvider = p
+	}
+}
+
+// Logs the client's debug and error output with debug and error instead of the package's loggers.
+// Pass nil to disable either.
+func WithLogger(debug Log, error Log) Option {
+	return func(q *QueueClient) {
+		q.logger = &internalLogger{logDebug: debug, logError: error}
+	}
+}
+
+// Sends the client's log records with structured fields to l, e.g. a *slog.Logger.
+func WithStructuredLogger(l Logger) Option {
+	return func(q *QueueClient) {
+		q.logger = &internalLogger{structured: l}
+	}
+}
+
+// Retries transient failures as per p, see QueueClient.RetryPolicy.
+func WithRetryPolicy(p *RetryPolicy) Option {
+	return func(q *QueueClient) {
+		q.RetryPolicy = p
+	}
+}
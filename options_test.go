@@ -0,0 +1,165 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func countingClient(n *int32) HttpClient {
+	return httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(n, 1)
+		return &http.Response{StatusCode: http.StatusCreated, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+	})
+}
+
+func Test_NewQueueClient(t *testing.T) {
+
+	provider := &SharedAccessKeyProvider{KeyName: "send", KeyValue: "sendvalue"}
+
+	cli := NewQueueClient("test", "orders",
+		WithEndpoint("http://localhost:8080"),
+		WithTimeout(30),
+		WithSharedAccessKey("key", "keyvalue"),
+		WithTokenProvider(provider),
+		WithRetryPolicy(testRetryPolicy))
+
+	if cli.Namespace != "test" || cli.QueueName != "orders" {
+		t.Fatalf("Expected namespace test and queue orders but got %s and %s", cli.Namespace, cli.QueueName)
+	}
+
+	if cli.Endpoint != "http://localhost:8080" || cli.Timeout != 30 {
+		t.Fatalf("Expected endpoint and timeout to be set but got %s and %d", cli.Endpoint, cli.Timeout)
+	}
+
+	if cli.KeyName != "key" || cli.KeyValue != "keyvalue" || cli.TokenProvider != provider {
+		t.Fatalf("Expected credentials to be set but got %s, %s and %v", cli.KeyName, cli.KeyValue, cli.TokenProvider)
+	}
+
+	if cli.RetryPolicy != testRetryPolicy {
+		t.Fatalf("Expected RetryPolicy %v but got %v", testRetryPolicy, cli.RetryPolicy)
+	}
+}
+
+func Test_WithHttpClient(t *testing.T) {
+
+	var first, second, global int32
+	SetHttpClient(countingClient(&global))
+	defer SetHttpClient(nil)
+
+	a := NewQueueClient("test", "a", WithHttpClient(countingClient(&first)))
+	b := NewQueueClient("test", "b", WithHttpClient(countingClient(&second)))
+	c := NewQueueClient("test", "c")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, cli := range []*QueueClient{a, b, c} {
+			wg.Add(1)
+			go func(cli *QueueClient) {
+				defer wg.Done()
+				if err := cli.SendMessage(NewMessage([]byte("Hello!"))); err != nil {
+					t.Error(err)
+				}
+			}(cli)
+		}
+	}
+	wg.Wait()
+
+	if first != 10 || second != 10 || global != 10 {
+		t.Fatalf("Expected 10 requests per http client but got %d, %d and %d", first, second, global)
+	}
+}
+
+func Test_WithHttpClient_derivedClients(t *testing.T) {
+
+	var n int32
+	cli := NewQueueClient("test", "test", WithHttpClient(countingClient(&n)))
+
+	if err := NewTopicClient(cli, "topic").SendMessage(NewMessage([]byte("Hello!"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.DeadLetterQueue().SendMessage(NewMessage([]byte("Hello!"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Fatalf("Expected 2 requests but got %d", n)
+	}
+}
+
+func Test_WithLogger(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("Hello!"))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	var debug int32
+	cli := NewQueueClient("test", "test", WithLogger(func(...interface{}) { atomic.AddInt32(&debug, 1) }, nil))
+
+	SetDebugLogger(func(...interface{}) { t.Fatal("Expected the client's debug logger to be used") })
+	defer SetDebugLogger(nil)
+
+	if _, err := cli.GetMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	if debug == 0 {
+		t.Fatal("Expected debug output of the client's logger")
+	}
+
+	before := atomic.LoadInt32(&debug)
+
+	if _, err := NewSubscriptionClient(cli, "topic", "sub").GetMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&debug) == before {
+		t.Fatal("Expected the subscription client to use the client's logger")
+	}
+}
+
+func Test_WithStructuredLogger(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Brokerproperties": []string{`{"MessageId":"1","DeliveryCount":2}`}},
+			Body:       ioutil.NopCloser(strings.NewReader("Hello!")),
+		}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	var buf bytes.Buffer
+	cli := NewQueueClient("test", "orders", WithStructuredLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+
+	if _, err := cli.GetMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := map[string]map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records[record["msg"].(string)] = record
+	}
+
+	resp := records["Response"]
+	if resp["queue"] != "orders" || resp["operation"] != "GetMessage" || resp["status_code"] != float64(200) || resp["latency"] == nil {
+		t.Fatalf("Unexpected response record %v", resp)
+	}
+
+	read := records["Message read"]
+	if read["queue"] != "orders" || read["message_id"] != "1" || read["delivery_count"] != float64(2) {
+		t.Fatalf("Unexpected message record %v", read)
+	}
+}
@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+)
+
+// PoisonPolicy routes messages that were delivered too many times to a sink
+// instead of handing them to the handler again.
+type PoisonPolicy struct {
+	// Messages with a DeliveryCount above it are poison.
+	MaxDeliveryCount int
+
+	// Takes the poison messages. Required.
+	// To dead-letter them instead, set MaxDeliveryCount of the queue and let the service move them.
+	Sink PoisonSink
+}
+
+// PoisonSink takes over a poison message still locked by the receiver it came from.
+// It must complete or unlock the message.
+type PoisonSink interface {
+	Poison(ctx context.Context, r Receiver, msg *Message) error
+}
+
+// PoisonSinkFunc adapts a callback to a PoisonSink. The callback must settle the message.
+type PoisonSinkFunc func(ctx context.Context, r Receiver, msg *Message) error
+
+func (f PoisonSinkFunc) Poison(ctx context.Context, r Receiver, msg *Message) error {
+	return f(ctx, r, msg)
+}
+
+// ForwardSink sends a copy of poison messages to another queue, e.g. a parking queue,
+// and deletes the originals.
+type ForwardSink struct {
+	Queue *QueueClient
+}
+
+func (s ForwardSink) Poison(ctx context.Context, r Receiver, msg *Message) error {
+	if err := s.Queue.SendMessageContext(ctx, msg); err != nil {
+		return wrap(err, "Poison message forward failed")
+	}
+
+	return r.DeleteMessageContext(ctx, msg)
+}
+
+// Reports whether msg is poison and hands it to the sink if so.
+func (p *PoisonPolicy) handle(ctx context.Context, r Receiver, msg *Message) (bool, error) {
+	if p == nil || p.MaxDeliveryCount <= 0 || msg.DeliveryCount <= p.MaxDeliveryCount {
+		return false, nil
+	}
+
+	loggerOf(r).Debug("Poison message", "message_id", msg.Id, "delivery_count", msg.DeliveryCount)
+
+	if p.Sink == nil {
+		return true, fmt.Errorf("PoisonPolicy requires a Sink")
+	}
+
+	return true, p.Sink.Poison(ctx, r, msg)
+}
+
+// Receives the next message that isn't poison as per policy.
+// Poison messages are handed to the policy's sink and the receive continues.
+// If the sink fails, its error is returned.
+func (q *QueueClient) GetMessageWithPoisonPolicy(ctx context.Context, policy *PoisonPolicy) (*Message, error) {
+	return getMessageWithPoisonPolicy(ctx, q, policy)
+}
+
+// Receives the next message that isn't poison as per policy, see QueueClient.GetMessageWithPoisonPolicy.
+func (s *SubscriptionClient) GetMessageWithPoisonPolicy(ctx context.Context, policy *PoisonPolicy) (*Message, error) {
+	return getMessageWithPoisonPolicy(ctx, s, policy)
+}
+
+func getMessageWithPoisonPolicy(ctx context.Context, r Receiver, policy *PoisonPolicy) (*Message, error) {
+	for {
+		msg, err := r.GetMessageContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		poison, err := policy.handle(ctx, r, msg)
+		if err != nil {
+			return nil, wrap(err, "Poison message "+msg.Id+" failed")
+		}
+
+		if !poison {
+			return msg, nil
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Returns a client serving messages with the given delivery counts and recording requests.
+// Once the messages run out receives block until cancelled.
+func poisonClient(deliveryCounts []int, paths *[]string) HttpClient {
+	var mu sync.Mutex
+	next := 0
+	return httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		*paths = append(*paths, req.Method+" "+req.URL.Path)
+
+		if strings.HasSuffix(req.URL.Path, "/messages/head") {
+			if next == len(deliveryCounts) {
+				mu.Unlock()
+				<-req.Context().Done()
+				mu.Lock()
+				return nil, req.Context().Err()
+			}
+
+			next++
+			props := fmt.Sprintf(`{"MessageId":"%d","LockToken":"token","DeliveryCount":%d}`, next, deliveryCounts[next-1])
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Brokerproperties": []string{props}},
+				Body:       ioutil.NopCloser(bytes.NewBufferString("")),
+			}, nil
+		}
+
+		return &http.Response{StatusCode: http.StatusCreated, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+	})
+}
+
+func Test_GetMessageWithPoisonPolicy_noSink(t *testing.T) {
+
+	var paths []string
+	SetHttpClient(poisonClient([]int{4, 3}, &paths))
+	defer SetHttpClient(nil)
+
+	if _, err := q.GetMessageWithPoisonPolicy(context.Background(), &PoisonPolicy{MaxDeliveryCount: 3}); err == nil {
+		t.Fatal("Expected missing Sink error but got nil")
+	}
+}
+
+func Test_GetMessageWithPoisonPolicy_forward(t *testing.T) {
+
+	var paths []string
+	SetHttpClient(poisonClient([]int{10, 1}, &paths))
+	defer SetHttpClient(nil)
+
+	parking := QueueClient{Namespace: "test", QueueName: "parking"}
+	policy := &PoisonPolicy{MaxDeliveryCount: 3, Sink: ForwardSink{Queue: &parking}}
+
+	if _, err := q.GetMessageWithPoisonPolicy(context.Background(), policy); err != nil {
+		t.Fatal(err)
+	}
+
+	comparePaths(t, []string{
+		"POST /test/messages/head",
+		"POST /parking/messages/",
+		"DELETE /test/messages/1/token",
+		"POST /test/messages/head",
+	}, paths)
+}
+
+func Test_GetMessageWithPoisonPolicy_callback(t *testing.T) {
+
+	var paths []string
+	SetHttpClient(poisonClient([]int{10}, &paths))
+	defer SetHttpClient(nil)
+
+	policy := &PoisonPolicy{
+		MaxDeliveryCount: 3,
+		Sink: PoisonSinkFunc(func(ctx context.Context, r Receiver, msg *Message) error {
+			return fmt.Errorf("sink failed")
+		}),
+	}
+
+	if _, err := q.GetMessageWithPoisonPolicy(context.Background(), policy); err == nil {
+		t.Fatal("Expected sink error but got nil")
+	}
+}
+
+func Test_Processor_poison(t *testing.T) {
+
+	var paths []string
+	SetHttpClient(poisonClient([]int{5, 1}, &paths))
+	defer SetHttpClient(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	parking := QueueClient{Namespace: "test", QueueName: "parking"}
+
+	var handled []string
+	p := Processor{
+		Client: &q,
+		Poison: &PoisonPolicy{MaxDeliveryCount: 3, Sink: ForwardSink{Queue: &parking}},
+		Handler: func(ctx context.Context, msg *Message) error {
+			handled = append(handled, msg.Id)
+			cancel()
+			return nil
+		},
+	}
+
+	if err := p.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handled) != 1 || handled[0] != "2" {
+		t.Fatalf("Expected only message 2 to be handled but got %v", handled)
+	}
+
+	if paths[1] != "POST /parking/messages/" || paths[2] != "DELETE /test/messages/1/token" {
+		t.Fatalf("Expected message 1 to be forwarded but got %v", paths)
+	}
+}
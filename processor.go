@@ -0,0 +1,216 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Delay before receiving again after a failed receive.
+const receiveErrorDelay = time.Second
+
+// Default of Processor.SettleTimeout.
+const defaultSettleTimeout = 30 * time.Second
+
+// Minimum interval between receives finding no message, so that a short or zero client Timeout doesn't spin.
+const emptyReceiveInterval = time.Second
+
+// Handler processes a received message.
+// Returning nil completes the message, returning an error abandons it for redelivery.
+type Handler func(ctx context.Context, msg *Message) error
+
+// Receiver is implemented by QueueClient and SubscriptionClient.
+type Receiver interface {
+	GetMessageContext(ctx context.Context) (*Message, error)
+	DeleteMessageContext(ctx context.Context, msg *Message) error
+	UnlockMessageContext(ctx context.Context, msg *Message) error
+	AutoRenewLock(ctx context.Context, msg *Message, maxDuration time.Duration) (stop func())
+}
+
+// Returns the logger of r if it's one of the package's clients, or else the package's logger.
+func loggerOf(r Receiver) internalLogger {
+	if l, ok := r.(interface{ log() internalLogger }); ok {
+		return l.log()
+	}
+
+	return logger
+}
+
+// Processor receives messages concurrently and dispatches them to a Handler.
+// Messages are deleted when the handler succeeds and unlocked when it fails.
+type Processor struct {
+	// Client messages are received from.
+	Client Receiver
+
+	// Handler invoked for every received message.
+	Handler Handler
+
+	// Maximum number of messages handled at the same time. Defaults to 1.
+	MaxConcurrency int
+
+	// Number of received messages buffered ahead of the handlers. Defaults to 0,
+	// which receives a message only when a handler is free to take it.
+	// Prefetched messages are locked while they wait, keep it well below what handlers process within the lock duration.
+	Prefetch int
+
+	// Maximum duration the lock of a message is renewed for while it's handled.
+	// Zero disables lock renewal.
+	MaxLockRenewal time.Duration
+
+	// Routes messages delivered too many times to a sink instead of the handler.
+	// Nil hands every message to the handler.
+	Poison *PoisonPolicy
+
+	// Maximum duration of deleting or unlocking a message once it's handled, including during shutdown,
+	// so that a stalled connection can't keep Run from returning. Defaults to 30 seconds.
+	SettleTimeout time.Duration
+}
+
+// Receives and handles messages until ctx is done.
+// On shutdown it stops receiving, unlocks prefetched messages and waits for running handlers to return.
+func (p *Processor) Run(ctx context.Context) error {
+
+	if p.Client == nil || p.Handler == nil {
+		return fmt.Errorf("Processor requires Client and Handler")
+	}
+
+	if p.Poison != nil && p.Poison.Sink == nil {
+		return fmt.Errorf("PoisonPolicy requires a Sink")
+	}
+
+	concurrency := p.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	prefetch := p.Prefetch
+	if prefetch < 0 {
+		prefetch = 0
+	}
+
+	// a slot is taken before a receive and freed once the message is settled,
+	// so no more than prefetch messages wait locked for a handler
+	slots := make(chan struct{}, concurrency+prefetch)
+	msgs := make(chan *Message, concurrency+prefetch)
+
+	var receivers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		receivers.Add(1)
+		go func() {
+			defer receivers.Done()
+			p.receive(ctx, slots, msgs)
+		}()
+	}
+
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for msg := range msgs {
+				if ctx.Err() != nil {
+					p.settle(msg, ctx.Err())
+				} else {
+					p.handle(ctx, msg)
+				}
+				<-slots
+			}
+		}()
+	}
+
+	receivers.Wait()
+	close(msgs)
+	workers.Wait()
+
+	return nil
+}
+
+func (p *Processor) receive(ctx context.Context, slots chan struct{}, msgs chan<- *Message) {
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+			return
+		case slots <- struct{}{}:
+		}
+
+		start := time.Now()
+		msg, err := getMessageWithPoisonPolicy(ctx, p.Client, p.Poison)
+
+		if err == nil {
+			msgs <- msg
+			continue
+		}
+
+		<-slots
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		delay := receiveErrorDelay
+		if errors.As(err, &NoMessagesAvailableError{}) {
+			delay = emptyReceiveInterval - time.Since(start)
+		} else {
+			loggerOf(p.Client).Error("Receive failed", "error", err)
+		}
+
+		if delay > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+func (p *Processor) handle(ctx context.Context, msg *Message) {
+
+	stop := func() {}
+	if p.MaxLockRenewal > 0 {
+		stop = p.Client.AutoRenewLock(ctx, msg, p.MaxLockRenewal)
+	}
+
+	err := p.invoke(ctx, msg)
+	stop()
+
+	p.settle(msg, err)
+}
+
+// Calls the handler, turning a panic into an error so the message is abandoned.
+func (p *Processor) invoke(ctx context.Context, msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Handler panic: %v", r)
+		}
+	}()
+
+	return p.Handler(ctx, msg)
+}
+
+// Completes the message if handling succeeded, abandons it otherwise.
+// Settling isn't bound to the processor's context so it still happens during shutdown, only to SettleTimeout.
+func (p *Processor) settle(msg *Message, handleErr error) {
+
+	timeout := p.SettleTimeout
+	if timeout <= 0 {
+		timeout = defaultSettleTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if handleErr == nil {
+		if err := p.Client.DeleteMessageContext(ctx, msg); err != nil {
+			loggerOf(p.Client).Error("Message delete failed", "message_id", msg.Id, "error", err)
+		}
+		return
+	}
+
+	loggerOf(p.Client).Debug("Message abandoned", "message_id", msg.Id, "error", handleErr)
+
+	if err := p.Client.UnlockMessageContext(ctx, msg); err != nil {
+		loggerOf(p.Client).Error("Message unlock failed", "message_id", msg.Id, "error", err)
+	}
+}
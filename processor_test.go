@@ -0,0 +1,276 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Stub queue serving count messages and recording settled message ids.
+type stubQueue struct {
+	mu       sync.Mutex
+	next     int
+	count    int
+	deleted  []string
+	unlocked []string
+
+	// Answers receives on an empty queue at once, like a zero Timeout.
+	noWait   bool
+	receives int
+
+	// Never answers deletes and unlocks, like a stalled connection.
+	stallSettle bool
+}
+
+func (s *stubQueue) Do(req *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := req.URL.Path
+
+	switch {
+	case req.Method == "POST" && strings.HasSuffix(path, "/messages/head"):
+		s.receives++
+		if s.next >= s.count && s.noWait {
+			return &http.Response{StatusCode: http.StatusNoContent, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+		}
+		if s.next >= s.count {
+			s.mu.Unlock()
+			<-req.Context().Done()
+			s.mu.Lock()
+			return nil, req.Context().Err()
+		}
+		s.next++
+		props := fmt.Sprintf(`{"MessageId":"%d","LockToken":"token"}`, s.next)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Brokerproperties": []string{props}},
+			Body:       ioutil.NopCloser(bytes.NewBufferString(strconv.Itoa(s.next))),
+		}, nil
+	case (req.Method == "DELETE" || req.Method == "PUT") && s.stallSettle:
+		s.mu.Unlock()
+		<-req.Context().Done()
+		s.mu.Lock()
+		return nil, req.Context().Err()
+	case req.Method == "DELETE":
+		s.deleted = append(s.deleted, strings.Split(path, "/")[3])
+	case req.Method == "PUT":
+		s.unlocked = append(s.unlocked, strings.Split(path, "/")[3])
+	}
+
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+}
+
+func (s *stubQueue) settled() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.deleted) + len(s.unlocked)
+}
+
+func Test_Processor(t *testing.T) {
+
+	stub := &stubQueue{count: 10}
+	SetHttpClient(stub)
+	defer SetHttpClient(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	handled := map[string]bool{}
+
+	p := Processor{
+		Client:         &q,
+		MaxConcurrency: 3,
+		Prefetch:       2,
+		Handler: func(ctx context.Context, msg *Message) error {
+			mu.Lock()
+			handled[msg.Id] = true
+			mu.Unlock()
+
+			n, _ := strconv.Atoi(string(msg.Body))
+			if n%2 == 0 {
+				return fmt.Errorf("even message")
+			}
+			if n == 5 {
+				panic("message 5")
+			}
+			return nil
+		},
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for stub.settled() < 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(handled) != 10 {
+		t.Fatalf("Expected 10 handled messages but got %d", len(handled))
+	}
+
+	if len(stub.deleted) != 4 {
+		t.Fatalf("Expected 4 deleted messages but got %v", stub.deleted)
+	}
+
+	if len(stub.unlocked) != 6 {
+		t.Fatalf("Expected 6 unlocked messages but got %v", stub.unlocked)
+	}
+}
+
+func Test_Processor_shutdown(t *testing.T) {
+
+	stub := &stubQueue{count: 1}
+	SetHttpClient(stub)
+	defer SetHttpClient(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	started := make(chan struct{})
+	p := Processor{
+		Client: &q,
+		Handler: func(ctx context.Context, msg *Message) error {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	<-started
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stub.deleted) != 1 {
+		t.Fatalf("Expected in-flight message to be deleted but got %v", stub.deleted)
+	}
+}
+
+func Test_Processor_settleTimeout(t *testing.T) {
+
+	stub := &stubQueue{count: 1, stallSettle: true}
+	SetHttpClient(stub)
+	defer SetHttpClient(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p := Processor{
+		Client:        &q,
+		SettleTimeout: 50 * time.Millisecond,
+		Handler: func(ctx context.Context, msg *Message) error {
+			cancel()
+			return nil
+		},
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Run to return once settling timed out")
+	}
+}
+
+func Test_Processor_invalid(t *testing.T) {
+
+	p := Processor{}
+
+	if err := p.Run(context.Background()); err == nil {
+		t.Fatal("Expected error for missing Client and Handler but got nil")
+	}
+}
+
+func Test_Processor_emptyQueue(t *testing.T) {
+
+	stub := &stubQueue{noWait: true}
+	SetHttpClient(stub)
+	defer SetHttpClient(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	p := Processor{
+		Client:         &q,
+		Handler:        func(ctx context.Context, msg *Message) error { return nil },
+		MaxConcurrency: 2,
+	}
+
+	if err := p.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if stub.receives > 2 {
+		t.Fatalf("Expected one receive per receiver but got %d", stub.receives)
+	}
+}
+
+func Test_Processor_noPrefetch(t *testing.T) {
+
+	stub := &stubQueue{count: 10}
+	SetHttpClient(stub)
+	defer SetHttpClient(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	release := make(chan struct{})
+	p := Processor{
+		Client: &q,
+		Handler: func(ctx context.Context, msg *Message) error {
+			<-release
+			return nil
+		},
+		MaxConcurrency: 2,
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	stub.mu.Lock()
+	received := stub.next
+	stub.mu.Unlock()
+
+	cancel()
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if received != 2 {
+		t.Fatalf("Expected 2 messages received for 2 busy handlers but got %d", received)
+	}
+}
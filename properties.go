@@ -0,0 +1,250 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypedProperties holds message properties with their type.
+// Values are strings, int64, float64, bool or time.Time; int, int32 and float32 values are sent too.
+//
+// Properties of a received message are set both here and, formatted as strings, in Message.Properties.
+// When a property is set in both, the typed value is sent unless the string in Message.Properties differs
+// from it and was changed after the message was received.
+type TypedProperties map[string]interface{}
+
+// Get gets the value associated with the given key formatted as a string,
+// dates as in HTTP headers. It is case insensitive like Properties.Get.
+// If there are no values associated with the key, Get returns "".
+func (p TypedProperties) Get(key string) string {
+	if p == nil {
+		return ""
+	}
+
+	return formatProperty(p[textproto.CanonicalMIMEHeaderKey(key)])
+}
+
+// Sets a string property.
+func (p TypedProperties) Set(key, value string) {
+	p[textproto.CanonicalMIMEHeaderKey(key)] = value
+}
+
+// Sets an integer property.
+func (p TypedProperties) SetInt64(key string, value int64) {
+	p[textproto.CanonicalMIMEHeaderKey(key)] = value
+}
+
+// Sets a floating-point property.
+func (p TypedProperties) SetFloat64(key string, value float64) {
+	p[textproto.CanonicalMIMEHeaderKey(key)] = value
+}
+
+// Sets a boolean property.
+func (p TypedProperties) SetBool(key string, value bool) {
+	p[textproto.CanonicalMIMEHeaderKey(key)] = value
+}
+
+// Sets a date property. Dates are sent with a precision of seconds.
+func (p TypedProperties) SetTime(key string, value time.Time) {
+	p[textproto.CanonicalMIMEHeaderKey(key)] = value
+}
+
+// Returns an integer property, false if the property isn't set or isn't an integer.
+func (p TypedProperties) GetInt64(key string) (int64, bool) {
+	switch v := p[textproto.CanonicalMIMEHeaderKey(key)].(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	}
+
+	return 0, false
+}
+
+// Returns a number property, false if the property isn't set or isn't a number.
+func (p TypedProperties) GetFloat64(key string) (float64, bool) {
+	switch v := p[textproto.CanonicalMIMEHeaderKey(key)].(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+
+	if i, ok := p.GetInt64(key); ok {
+		return float64(i), true
+	}
+
+	return 0, false
+}
+
+// Returns a boolean property, false if the property isn't set or isn't a boolean.
+func (p TypedProperties) GetBool(key string) (value bool, ok bool) {
+	value, ok = p[textproto.CanonicalMIMEHeaderKey(key)].(bool)
+	return
+}
+
+// Returns a date property, false if the property isn't set or isn't a date.
+func (p TypedProperties) GetTime(key string) (time.Time, bool) {
+	t, ok := p[textproto.CanonicalMIMEHeaderKey(key)].(time.Time)
+	return t, ok
+}
+
+func formatProperty(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(http.TimeFormat)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Encodes the custom properties of a message by canonical key.
+// A typed value is sent unless Properties holds a different string for the key that was set after the message
+// was received, so that neither a string nor a typed value written by the caller is overridden by a stale copy.
+func encodeProperties(msg *Message) (map[string]string, error) {
+	strs := map[string]string{}
+	for k, v := range msg.Properties {
+		strs[textproto.CanonicalMIMEHeaderKey(k)] = v
+	}
+
+	encoded := map[string]string{}
+
+	for k, v := range msg.TypedProperties {
+		key := textproto.CanonicalMIMEHeaderKey(k)
+		received, wasReceived := msg.receivedProperties[key]
+
+		s, ok := strs[key]
+		switch {
+		case !ok && wasReceived:
+			// removed from Properties since it was received
+			continue
+		case ok && s != formatProperty(v) && (!wasReceived || s != received):
+			continue
+		}
+
+		value, err := encodeProperty(v)
+		if err != nil {
+			return nil, wrap(err, "Property "+k+" encode failed")
+		}
+		encoded[key] = value
+		delete(strs, key)
+	}
+
+	for k, v := range strs {
+		value, err := encodeProperty(v)
+		if err != nil {
+			return nil, wrap(err, "Property "+k+" encode failed")
+		}
+		encoded[k] = value
+	}
+
+	return encoded, nil
+}
+
+// Encodes a property value as JSON, the format of custom properties in headers:
+// strings and dates are quoted, dates formatted as in HTTP headers.
+//
+// See https://docs.microsoft.com/en-us/rest/api/servicebus/message-headers-and-properties
+func encodeProperty(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return quoteProperty(v)
+	case time.Time:
+		return quoteProperty(v.UTC().Format(http.TimeFormat))
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float32:
+		return encodeFloat(float64(v))
+	case float64:
+		return encodeFloat(v)
+	}
+
+	return "", fmt.Errorf("Unsupported property type %T", v)
+}
+
+func quoteProperty(s string) (string, error) {
+	b := &bytes.Buffer{}
+
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// Floats always have a fraction or exponent, so that they aren't received as integers.
+func encodeFloat(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("Unsupported property value %v", f)
+	}
+
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+
+	return s, nil
+}
+
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// Decodes a property header value encoded by encodeProperty.
+// Values that aren't JSON, like headers that aren't custom properties, are returned as strings.
+func decodeProperty(s string) interface{} {
+
+	if strings.HasPrefix(s, "\"") {
+		var str string
+		if err := json.Unmarshal([]byte(s), &str); err != nil {
+			return strings.Trim(s, "\"")
+		}
+
+		if t, err := time.Parse(http.TimeFormat, str); err == nil {
+			return t
+		}
+
+		return str
+	}
+
+	switch {
+	case s == "true":
+		return true
+	case s == "false":
+		return false
+	case !jsonNumber.MatchString(s):
+		return s
+	}
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+
+	return s
+}
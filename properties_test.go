@@ -0,0 +1,231 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_encodeProperty(t *testing.T) {
+
+	date := time.Date(2018, 2, 21, 21, 3, 56, 0, time.FixedZone("NZDT", 13*60*60))
+
+	tests := []struct {
+		value   interface{}
+		encoded string
+		decoded interface{}
+	}{
+		{"Value", `"Value"`, "Value"},
+		{`"quoted" <tag>`, `"\"quoted\" <tag>"`, `"quoted" <tag>`},
+		{"42", `"42"`, "42"},
+		{int64(42), "42", int64(42)},
+		{-7, "-7", int64(-7)},
+		{1.5, "1.5", 1.5},
+		{2.0, "2.0", 2.0},
+		{1e21, "1e+21", 1e21},
+		{true, "true", true},
+		{false, "false", false},
+		{date, `"Wed, 21 Feb 2018 08:03:56 GMT"`, date.UTC()},
+	}
+
+	for _, test := range tests {
+		encoded, err := encodeProperty(test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if encoded != test.encoded {
+			t.Fatalf("Expected %v to be encoded as %s but got %s", test.value, test.encoded, encoded)
+		}
+
+		if decoded := decodeProperty(encoded); !reflect.DeepEqual(decoded, test.decoded) {
+			t.Fatalf("Expected %s to be decoded as %#v but got %#v", encoded, test.decoded, decoded)
+		}
+	}
+
+	for _, value := range []interface{}{math.NaN(), math.Inf(1), struct{}{}, uint64(1)} {
+		if _, err := encodeProperty(value); err == nil {
+			t.Fatalf("Expected error encoding %#v", value)
+		}
+	}
+}
+
+func Test_decodeProperty_notJSON(t *testing.T) {
+
+	// headers that aren't custom properties are kept as strings
+	for _, s := range []string{"Value", "007", "+1", "NaN", "0x10", "max-age=31536000", `"unterminated`} {
+		if _, ok := decodeProperty(s).(string); !ok {
+			t.Fatalf("Expected %s to be decoded as a string but got %#v", s, decodeProperty(s))
+		}
+	}
+}
+
+func Test_Properties_typed(t *testing.T) {
+
+	date := time.Date(2018, 2, 21, 21, 3, 56, 0, time.UTC)
+
+	p := TypedProperties{}
+	p.SetInt64("count", 42)
+	p.SetFloat64("ratio", 0.5)
+	p.SetBool("urgent", true)
+	p.SetTime("due", date)
+	p.Set("name", "Value")
+
+	if v, ok := p.GetInt64("Count"); !ok || v != 42 {
+		t.Fatalf("Expected count 42 but got %v, %v", v, ok)
+	}
+
+	if v, ok := p.GetFloat64("count"); !ok || v != 42 {
+		t.Fatalf("Expected count 42 as float but got %v, %v", v, ok)
+	}
+
+	if v, ok := p.GetFloat64("ratio"); !ok || v != 0.5 {
+		t.Fatalf("Expected ratio 0.5 but got %v, %v", v, ok)
+	}
+
+	if v, ok := p.GetBool("urgent"); !ok || !v {
+		t.Fatalf("Expected urgent true but got %v, %v", v, ok)
+	}
+
+	if v, ok := p.GetTime("due"); !ok || !v.Equal(date) {
+		t.Fatalf("Expected due %v but got %v, %v", date, v, ok)
+	}
+
+	if _, ok := p.GetInt64("name"); ok {
+		t.Fatal("Expected a string property not to be an integer")
+	}
+
+	gets := map[string]string{
+		"count":   "42",
+		"ratio":   "0.5",
+		"urgent":  "true",
+		"due":     "Wed, 21 Feb 2018 21:03:56 GMT",
+		"name":    "Value",
+		"missing": "",
+	}
+
+	for k, expected := range gets {
+		if p.Get(k) != expected {
+			t.Fatalf("Expected property %s value %s but got %s", k, expected, p.Get(k))
+		}
+	}
+}
+
+func Test_Properties_sendReceive(t *testing.T) {
+
+	msg := NewMessage([]byte("hello"))
+	msg.TypedProperties.SetInt64("Count", 42)
+	msg.TypedProperties.SetFloat64("Ratio", 2)
+	msg.TypedProperties.SetBool("Urgent", true)
+	msg.TypedProperties.SetTime("Due", time.Date(2018, 2, 21, 21, 3, 56, 0, time.UTC))
+	msg.TypedProperties.Set("Name", "42")
+	msg.Properties.Set("Label", "Value")
+
+	req, err := q.createRequestFromMessage(context.Background(), "messages/", "POST", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the service returns custom properties as they were sent
+	resp := &http.Response{Header: req.Header, Body: ioutil.NopCloser(bytes.NewBufferString(""))}
+	received, err := q.parseMessage(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range msg.TypedProperties {
+		if !reflect.DeepEqual(received.TypedProperties[k], v) {
+			t.Fatalf("Expected property %s value %#v but got %#v", k, v, received.TypedProperties[k])
+		}
+	}
+
+	formatted := map[string]string{
+		"Count":  "42",
+		"Ratio":  "2",
+		"Urgent": "true",
+		"Due":    "Wed, 21 Feb 2018 21:03:56 GMT",
+		"Name":   "42",
+		"Label":  "Value",
+	}
+
+	for k, expected := range formatted {
+		if received.Properties[k] != expected {
+			t.Fatalf("Expected property %s value %s but got %s", k, expected, received.Properties[k])
+		}
+	}
+
+	if received.TypedProperties["Label"] != "Value" {
+		t.Fatalf("Expected string property Label value Value but got %#v", received.TypedProperties["Label"])
+	}
+}
+
+func Test_Properties_precedence(t *testing.T) {
+
+	msg := NewMessage([]byte("hello"))
+	msg.Properties.Set("Count", "forty-two")
+	msg.TypedProperties.SetInt64("count", 42)
+	msg.Properties.Set("Ratio", "0.5")
+	msg.TypedProperties.SetFloat64("ratio", 0.5)
+
+	req, err := q.createRequestFromMessage(context.Background(), "messages/", "POST", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a string that differs from the typed value was set on purpose
+	if req.Header.Get("Count") != `"forty-two"` {
+		t.Fatalf("Expected header Count value \"forty-two\" but got %s", req.Header.Get("Count"))
+	}
+
+	if req.Header.Get("Ratio") != "0.5" {
+		t.Fatalf("Expected header Ratio value 0.5 but got %s", req.Header.Get("Ratio"))
+	}
+}
+
+func Test_Properties_resend(t *testing.T) {
+
+	resp := &http.Response{
+		Header: http.Header{
+			"Foo":   []string{`"old"`},
+			"Count": []string{"42"},
+			"Ratio": []string{"0.5"},
+			"Gone":  []string{`"gone"`},
+			"Kept":  []string{"true"},
+		},
+		Body: ioutil.NopCloser(bytes.NewBufferString("")),
+	}
+
+	msg, err := q.parseMessage(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg.Properties.Set("Foo", "new")
+	msg.Properties.Set("Ratio", "half")
+	msg.TypedProperties.SetInt64("Count", 43)
+	delete(msg.Properties, "Gone")
+
+	req, err := q.createRequestFromMessage(context.Background(), "messages/", "POST", msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string]string{
+		"Foo":   `"new"`,
+		"Ratio": `"half"`,
+		"Count": "43",
+		"Gone":  "",
+		"Kept":  "true",
+	}
+
+	for k, expected := range headers {
+		if req.Header.Get(k) != expected {
+			t.Fatalf("Expected header %s value %s but got %s", k, expected, req.Header.Get(k))
+		}
+	}
+}
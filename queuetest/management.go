@@ -0,0 +1,209 @@
+package queuetest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const contentTypeAtom = "application/atom+xml;type=entry;charset=utf-8"
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string       `xml:"title"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom entry"`
+	Title   string      `xml:"title"`
+	Content atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type        string           `xml:"type,attr"`
+	Description queueDescription `xml:"http://schemas.microsoft.com/netservices/2010/10/servicebus/connect QueueDescription"`
+}
+
+// The settings of a queue are stored as sent and returned as is, followed by its runtime metrics.
+type queueDescription struct {
+	Inner string `xml:",innerxml"`
+}
+
+// Serves the Atom/XML entity endpoints creating, updating, deleting, getting and listing queues.
+func (s *Server) serveManagement(w http.ResponseWriter, r *http.Request, path string) {
+
+	switch {
+	case path == "$Resources/Queues" && r.Method == "GET":
+		s.listQueues(w, r)
+	case path != "" && r.Method == "GET":
+		s.getQueue(w, path)
+	case path != "" && r.Method == "PUT":
+		s.putQueue(w, r, path)
+	case path != "" && r.Method == "DELETE":
+		s.deleteQueue(w, path)
+	default:
+		http.Error(w, "Not Found", http.StatusNotFound)
+	}
+}
+
+func (s *Server) listQueues(w http.ResponseWriter, r *http.Request) {
+
+	skip, _ := strconv.Atoi(r.URL.Query().Get("$skip"))
+	top, err := strconv.Atoi(r.URL.Query().Get("$top"))
+	if err != nil {
+		top = 100
+	}
+
+	s.mu.Lock()
+	var names []string
+	for name := range s.queues {
+		if !strings.HasSuffix(name, "/"+deadLetterQueueName) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	feed := atomFeed{Title: "Queues"}
+	for i := skip; i < len(names) && i < skip+top; i++ {
+		feed.Entries = append(feed.Entries, s.queueEntry(names[i]))
+	}
+	s.mu.Unlock()
+
+	writeXML(w, http.StatusOK, feed)
+}
+
+// Returns the entry of the queue, or an empty feed like the service if it doesn't exist.
+func (s *Server) getQueue(w http.ResponseWriter, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.queues[name]; !ok {
+		writeXML(w, http.StatusOK, atomFeed{Title: "Publicly Listed Services"})
+		return
+	}
+
+	writeXML(w, http.StatusOK, s.queueEntry(name))
+}
+
+// Creates a queue, or updates it if If-Match is set.
+func (s *Server) putQueue(w http.ResponseWriter, r *http.Request, name string) {
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e := atomEntry{}
+	if err := xml.Unmarshal(body, &e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, exists := s.queues[name]
+	update := r.Header.Get("If-Match") != ""
+
+	switch {
+	case update && !exists:
+		http.Error(w, "Entity "+name+" does not exist", http.StatusNotFound)
+		return
+	case !update && exists:
+		http.Error(w, "Entity "+name+" already exists", http.StatusConflict)
+		return
+	case !exists:
+		q = newEntity()
+		s.queues[name] = q
+	}
+
+	q.description = e.Content.Description.Inner
+	q.updatedAt = time.Now().UTC()
+
+	status := http.StatusCreated
+	if update {
+		status = http.StatusOK
+	}
+
+	writeXML(w, status, s.queueEntry(name))
+}
+
+// Deletes a queue with its messages and dead-letter sub-queue.
+func (s *Server) deleteQueue(w http.ResponseWriter, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.queues[name]; !ok {
+		http.Error(w, "Entity "+name+" does not exist", http.StatusNotFound)
+		return
+	}
+
+	delete(s.queues, name)
+	delete(s.queues, name+"/"+deadLetterQueueName)
+	s.notify()
+}
+
+// Returns the Atom entry describing a queue with its runtime metrics. Must be called with s.mu held.
+func (s *Server) queueEntry(name string) *atomEntry {
+	q := s.queues[name]
+	now := time.Now()
+
+	var size, active, scheduled int
+	for _, msg := range q.messages {
+		size += len(msg.body)
+		if msg.scheduled.After(now) {
+			scheduled++
+		} else {
+			active++
+		}
+	}
+
+	var deadLetter int
+	if dlq, ok := s.queues[name+"/"+deadLetterQueueName]; ok {
+		deadLetter = len(dlq.messages)
+		for _, msg := range dlq.messages {
+			size += len(msg.body)
+		}
+	}
+
+	runtime := fmt.Sprintf(
+		"<SizeInBytes>%d</SizeInBytes><MessageCount>%d</MessageCount>"+
+			"<CreatedAt>%s</CreatedAt><UpdatedAt>%s</UpdatedAt><AccessedAt>%s</AccessedAt>"+
+			`<CountDetails xmlns:d2p1="http://schemas.microsoft.com/netservices/2011/06/servicebus">`+
+			"<d2p1:ActiveMessageCount>%d</d2p1:ActiveMessageCount>"+
+			"<d2p1:DeadLetterMessageCount>%d</d2p1:DeadLetterMessageCount>"+
+			"<d2p1:ScheduledMessageCount>%d</d2p1:ScheduledMessageCount>"+
+			"<d2p1:TransferMessageCount>0</d2p1:TransferMessageCount>"+
+			"<d2p1:TransferDeadLetterMessageCount>0</d2p1:TransferDeadLetterMessageCount>"+
+			"</CountDetails>",
+		size, active+scheduled+deadLetter,
+		q.createdAt.Format(time.RFC3339Nano), q.updatedAt.Format(time.RFC3339Nano), q.accessedAt.Format(time.RFC3339Nano),
+		active, deadLetter, scheduled)
+
+	return &atomEntry{
+		Title: name,
+		Content: atomContent{
+			Type:        "application/xml",
+			Description: queueDescription{Inner: q.description + runtime},
+		},
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(headerContentType, contentTypeAtom)
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,584 @@
+// Package queuetest provides an in-process fake of the Azure Service Bus REST API for tests.
+//
+// The fake implements sending (single messages and batches), scheduling messages, peek-lock and
+// receive-and-delete reads with long-polling, unlocking, renewing locks and deleting messages,
+// and expires locks after LockDuration.
+// Every queue has a dead-letter sub-queue at <queue>/$DeadLetterQueue, where messages delivered
+// more than MaxDeliveryCount times are moved, like the service does.
+// Queues can also be created, updated, deleted, got and listed through the Atom/XML entity endpoints.
+// Requests are authorized with Shared Access Signature tokens signed with KeyName and KeyValue.
+package queuetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const deadLetterQueueName = "$DeadLetterQueue"
+
+const (
+	headerAuthorization    = "Authorization"
+	headerBrokerProperties = "BrokerProperties"
+	headerContentType      = "Content-Type"
+
+	contentTypeBatch = "application/vnd.microsoft.servicebus.json"
+)
+
+// Headers of a send request that aren't custom message properties.
+var standardHeaders = map[string]bool{
+	"Accept-Encoding":  true,
+	"Authorization":    true,
+	"Brokerproperties": true,
+	"Content-Length":   true,
+	"Content-Type":     true,
+	"User-Agent":       true,
+}
+
+// Server is a fake Service Bus namespace serving queues over HTTP.
+type Server struct {
+	// Base URL of the fake namespace, e.g. http://127.0.0.1:50000. Use it as QueueClient.Endpoint.
+	URL string
+
+	// Policy name and value requests must be signed with.
+	// If KeyName is empty requests aren't authorized.
+	KeyName  string
+	KeyValue string
+
+	// Lock duration of received messages. Defaults to 30 seconds.
+	LockDuration time.Duration
+
+	// Number of deliveries after which a message is dead-lettered instead of delivered again. Defaults to 10.
+	MaxDeliveryCount int
+
+	server *httptest.Server
+
+	mu       sync.Mutex
+	queues   map[string]*entity
+	sequence int64
+
+	// closed and replaced whenever messages change, wakes up long-polling receivers
+	changed chan struct{}
+}
+
+type entity struct {
+	messages []*message
+
+	// inner XML of the QueueDescription the queue was created or updated with
+	description string
+
+	createdAt  time.Time
+	updatedAt  time.Time
+	accessedAt time.Time
+}
+
+type message struct {
+	id            string
+	lockToken     string
+	lockedUntil   time.Time
+	deliveryCount int
+	sequence      int64
+	enqueued      time.Time
+	scheduled     time.Time
+
+	body        []byte
+	contentType string
+	broker      map[string]interface{}
+	properties  map[string]string
+}
+
+// Starts a fake namespace authorizing requests signed with keyName and keyValue.
+// The caller should call Close when finished, to shut it down.
+func NewServer(keyName string, keyValue string) *Server {
+	s := &Server{
+		KeyName:  keyName,
+		KeyValue: keyValue,
+		queues:   map[string]*entity{},
+		changed:  make(chan struct{}),
+	}
+
+	s.server = httptest.NewServer(s)
+	s.URL = s.server.URL
+
+	return s
+}
+
+// Shuts down the server and blocks until all outstanding requests on this server have completed.
+func (s *Server) Close() {
+	s.server.CloseClientConnections()
+	s.server.Close()
+}
+
+// Creates an empty queue. Requests to queues that don't exist fail with 410 Gone.
+func (s *Server) CreateQueue(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.queues[name]; !ok {
+		s.queues[name] = newEntity()
+	}
+}
+
+// Returns the number of messages in a queue, locked or not.
+func (s *Server) MessageCount(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q, ok := s.queues[name]; ok {
+		return len(q.messages)
+	}
+
+	return 0
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if !s.authorize(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+
+	i := strings.LastIndex(path, "/messages")
+	if i <= 0 {
+		s.serveManagement(w, r, path)
+		return
+	}
+
+	name := path[:i]
+	rest := strings.Trim(path[i+len("/messages"):], "/")
+
+	if !s.exists(name) {
+		http.Error(w, "Entity "+name+" does not exist", http.StatusGone)
+		return
+	}
+
+	segments := strings.Split(rest, "/")
+
+	switch {
+	case rest == "" && r.Method == "POST":
+		s.send(w, r, name)
+	case rest == "head" && r.Method == "POST":
+		s.receive(w, r, name, true)
+	case rest == "head" && r.Method == "DELETE":
+		s.receive(w, r, name, false)
+	case len(segments) == 2 && r.Method == "PUT":
+		s.settle(w, name, segments[0], segments[1], s.unlock)
+	case len(segments) == 2 && r.Method == "POST":
+		s.settle(w, name, segments[0], segments[1], s.renew)
+	case len(segments) == 2 && r.Method == "DELETE":
+		s.settle(w, name, segments[0], segments[1], s.delete)
+	default:
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+	}
+}
+
+// Reports whether a queue exists, creating the dead-letter sub-queue of an existing queue on first use.
+func (s *Server) exists(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.queues[name]; ok {
+		return true
+	}
+
+	parent := strings.TrimSuffix(name, "/"+deadLetterQueueName)
+	if _, ok := s.queues[parent]; ok && parent != name {
+		s.queues[name] = newEntity()
+		return true
+	}
+
+	return false
+}
+
+// Checks the Shared Access Signature token of a request.
+//
+// See https://docs.microsoft.com/en-us/azure/service-bus-messaging/service-bus-sas
+func (s *Server) authorize(r *http.Request) bool {
+
+	if s.KeyName == "" {
+		return true
+	}
+
+	const prefix = "SharedAccessSignature "
+
+	header := r.Header.Get(headerAuthorization)
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+
+	// the signature is computed over the encoded resource, so the fields are split without decoding them
+	fields := map[string]string{}
+	for _, field := range strings.Split(strings.TrimPrefix(header, prefix), "&") {
+		if kv := strings.SplitN(field, "=", 2); len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+
+	if fields["skn"] != s.KeyName {
+		return false
+	}
+
+	expiry, err := strconv.ParseInt(fields["se"], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return false
+	}
+
+	sig, err := url.QueryUnescape(fields["sig"])
+	if err != nil {
+		return false
+	}
+
+	h := hmac.New(sha256.New, []byte(s.KeyValue))
+	h.Write([]byte(fields["sr"] + "\n" + fields["se"]))
+	if !hmac.Equal([]byte(sig), []byte(base64.StdEncoding.EncodeToString(h.Sum(nil)))) {
+		return false
+	}
+
+	// the token must be scoped to the requested resource
+	resource, err := url.QueryUnescape(fields["sr"])
+	if err != nil {
+		return false
+	}
+
+	requested := strings.ToLower("http://" + r.Host + r.URL.Path)
+	resource = strings.Replace(strings.ToLower(resource), "https://", "http://", 1)
+
+	return strings.HasPrefix(requested, resource)
+}
+
+func (s *Server) send(w http.ResponseWriter, r *http.Request, name string) {
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var msgs []*message
+
+	if r.Header.Get(headerContentType) == contentTypeBatch {
+		if msgs, err = decodeBatch(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		msg := &message{
+			body:        body,
+			contentType: r.Header.Get(headerContentType),
+			broker:      map[string]interface{}{},
+			properties:  map[string]string{},
+		}
+
+		if p := r.Header.Get(headerBrokerProperties); p != "" {
+			if err := json.Unmarshal([]byte(p), &msg.broker); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		for k, v := range r.Header {
+			if !standardHeaders[k] {
+				msg.properties[k] = v[0]
+			}
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	s.mu.Lock()
+	for _, msg := range msgs {
+		s.enqueue(name, msg)
+	}
+	s.notify()
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Decodes the Service Bus batch format.
+//
+// See https://docs.microsoft.com/en-us/rest/api/servicebus/send-message-batch
+func decodeBatch(body []byte) ([]*message, error) {
+
+	var entries []struct {
+		Body             string
+		BrokerProperties map[string]interface{}
+		UserProperties   map[string]interface{}
+	}
+
+	// numbers are kept as sent, so that floats like 2.0 aren't returned as integers
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&entries); err != nil {
+		return nil, err
+	}
+
+	var msgs []*message
+
+	for _, e := range entries {
+		msg := &message{
+			body:       []byte(e.Body),
+			broker:     e.BrokerProperties,
+			properties: map[string]string{},
+		}
+
+		if msg.broker == nil {
+			msg.broker = map[string]interface{}{}
+		}
+
+		// property values are returned as header values, strings quoted
+		for k, v := range e.UserProperties {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			msg.properties[http.CanonicalHeaderKey(k)] = string(b)
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
+}
+
+// Appends a message to a queue. Must be called with s.mu held.
+func (s *Server) enqueue(name string, msg *message) {
+
+	s.sequence++
+	msg.sequence = s.sequence
+	msg.enqueued = time.Now().UTC()
+
+	if at, ok := msg.broker["ScheduledEnqueueTimeUtc"].(string); ok {
+		if t, err := time.Parse(http.TimeFormat, at); err == nil {
+			msg.scheduled = t
+		}
+	}
+
+	if id, ok := msg.broker["MessageId"].(string); ok && id != "" {
+		msg.id = id
+	} else {
+		msg.id = newToken()
+	}
+
+	q := s.queues[name]
+	q.messages = append(q.messages, msg)
+	q.accessedAt = msg.enqueued
+}
+
+// Wakes up long-polling receivers. Must be called with s.mu held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) receive(w http.ResponseWriter, r *http.Request, name string, peekLock bool) {
+
+	timeout, _ := strconv.Atoi(r.URL.Query().Get("timeout"))
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	for {
+		s.mu.Lock()
+		msg := s.take(name, peekLock)
+		changed := s.changed
+		s.mu.Unlock()
+
+		if msg != nil {
+			writeMessage(w, msg, peekLock)
+			return
+		}
+
+		// locks expiring make messages available too
+		select {
+		case <-ctx.Done():
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-changed:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// Returns the first available message of a queue, locking or removing it. Must be called with s.mu held.
+func (s *Server) take(name string, peekLock bool) *message {
+
+	q := s.queues[name]
+	now := time.Now()
+
+	for i := 0; i < len(q.messages); i++ {
+		msg := q.messages[i]
+
+		if msg.lockedUntil.After(now) || msg.scheduled.After(now) {
+			continue
+		}
+
+		if msg.deliveryCount >= s.maxDeliveryCount() && !strings.HasSuffix(name, "/"+deadLetterQueueName) {
+			s.deadLetter(name, q, i, "MaxDeliveryCountExceeded",
+				fmt.Sprintf("Message could not be consumed after %d delivery attempts.", msg.deliveryCount))
+			i--
+			continue
+		}
+
+		msg.deliveryCount++
+		q.accessedAt = now.UTC()
+
+		if !peekLock {
+			q.messages = append(q.messages[:i], q.messages[i+1:]...)
+			c := *msg
+			return &c
+		}
+
+		msg.lockToken = newToken()
+		msg.lockedUntil = now.Add(s.lockDuration())
+
+		c := *msg
+		return &c
+	}
+
+	return nil
+}
+
+func writeMessage(w http.ResponseWriter, msg *message, peekLock bool) {
+
+	broker := map[string]interface{}{}
+	for k, v := range msg.broker {
+		broker[k] = v
+	}
+
+	broker["MessageId"] = msg.id
+	broker["DeliveryCount"] = msg.deliveryCount
+	broker["SequenceNumber"] = msg.sequence
+	broker["EnqueuedTimeUtc"] = msg.enqueued.Format(http.TimeFormat)
+
+	if peekLock {
+		broker["LockToken"] = msg.lockToken
+		broker["LockedUntilUtc"] = msg.lockedUntil.UTC().Format(http.TimeFormat)
+	}
+
+	b, _ := json.Marshal(broker)
+	w.Header().Set(headerBrokerProperties, string(b))
+
+	for k, v := range msg.properties {
+		w.Header().Set(k, v)
+	}
+
+	if msg.contentType != "" {
+		w.Header().Set(headerContentType, msg.contentType)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	w.Write(msg.body)
+}
+
+// Applies a settle operation to the message locked with lockToken. Must be called with s.mu held.
+type settleFunc func(q *entity, i int, w http.ResponseWriter)
+
+func (s *Server) settle(w http.ResponseWriter, name string, id string, lockToken string, f settleFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.queues[name]
+
+	for i, msg := range q.messages {
+		if msg.id != id || msg.lockToken != lockToken {
+			continue
+		}
+
+		if !msg.lockedUntil.After(time.Now()) {
+			http.Error(w, "The lock supplied is invalid. Either the lock expired, or the message has already been removed from the queue.", http.StatusNotFound)
+			return
+		}
+
+		f(q, i, w)
+		s.notify()
+		return
+	}
+
+	http.Error(w, "No message was found with the specified MessageId or LockToken", http.StatusNotFound)
+}
+
+func (s *Server) unlock(q *entity, i int, w http.ResponseWriter) {
+	q.messages[i].lockToken = ""
+	q.messages[i].lockedUntil = time.Time{}
+}
+
+func (s *Server) renew(q *entity, i int, w http.ResponseWriter) {
+	msg := q.messages[i]
+	msg.lockedUntil = time.Now().Add(s.lockDuration())
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"LockedUntilUtc": msg.lockedUntil.UTC().Format(http.TimeFormat),
+	})
+	w.Header().Set(headerBrokerProperties, string(b))
+}
+
+func (s *Server) delete(q *entity, i int, w http.ResponseWriter) {
+	q.messages = append(q.messages[:i], q.messages[i+1:]...)
+}
+
+// Moves a message to the dead-letter sub-queue with reason and description. Must be called with s.mu held.
+func (s *Server) deadLetter(name string, q *entity, i int, reason string, description string) {
+	msg := q.messages[i]
+	q.messages = append(q.messages[:i], q.messages[i+1:]...)
+
+	msg.lockToken = ""
+	msg.lockedUntil = time.Time{}
+	msg.properties["Deadletterreason"] = strconv.Quote(reason)
+	msg.properties["Deadlettererrordescription"] = strconv.Quote(description)
+
+	dlq, ok := s.queues[name+"/"+deadLetterQueueName]
+	if !ok {
+		dlq = newEntity()
+		s.queues[name+"/"+deadLetterQueueName] = dlq
+	}
+	dlq.messages = append(dlq.messages, msg)
+}
+
+func (s *Server) maxDeliveryCount() int {
+	if s.MaxDeliveryCount <= 0 {
+		return 10
+	}
+
+	return s.MaxDeliveryCount
+}
+
+func (s *Server) lockDuration() time.Duration {
+	if s.LockDuration <= 0 {
+		return 30 * time.Second
+	}
+
+	return s.LockDuration
+}
+
+func newEntity() *entity {
+	now := time.Now().UTC()
+	return &entity{createdAt: now, updatedAt: now}
+}
+
+// Returns a random identifier formatted as a GUID.
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("queuetest: random token failed: %v", err))
+	}
+
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
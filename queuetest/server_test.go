@@ -0,0 +1,516 @@
+package queuetest_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	queue "github.com/g-rad/go-azurequeue"
+	"github.com/g-rad/go-azurequeue/queuetest"
+)
+
+func TestMain(m *testing.M) {
+	queue.SetDebugLogger(nil)
+	m.Run()
+}
+
+func newClient(s *queuetest.Server) *queue.QueueClient {
+	s.CreateQueue("test")
+
+	return &queue.QueueClient{
+		Endpoint:  s.URL,
+		KeyName:   s.KeyName,
+		KeyValue:  s.KeyValue,
+		QueueName: "test",
+		Timeout:   1,
+	}
+}
+
+func TestServer_SendReceive(t *testing.T) {
+
+	s := queuetest.NewServer("key", "keyvalue")
+	defer s.Close()
+
+	cli := newClient(s)
+
+	msgSend := queue.NewMessage([]byte("Hello!"))
+	msgSend.Id = "1"
+	msgSend.Label = "label"
+	msgSend.ContentType = "text/plain"
+	msgSend.Properties.Set("Prop1", "Value1")
+
+	if err := cli.SendMessage(msgSend); err != nil {
+		t.Fatal(err)
+	}
+
+	msgReceive, err := cli.GetMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(msgReceive.Body) != "Hello!" {
+		t.Fatalf("Expected body %s but got %s", "Hello!", string(msgReceive.Body))
+	}
+
+	if msgReceive.Id != "1" || msgReceive.Label != "label" || msgReceive.ContentType != "text/plain" {
+		t.Fatalf("Expected Id, Label and ContentType to be sent but got %+v", msgReceive)
+	}
+
+	if msgReceive.Properties.Get("Prop1") != "Value1" {
+		t.Fatalf("Expected property Prop1 value %s but got %s", "Value1", msgReceive.Properties.Get("Prop1"))
+	}
+
+	if msgReceive.LockToken == "" || msgReceive.DeliveryCount != 1 || msgReceive.SequenceNumber != 1 {
+		t.Fatalf("Expected locked first delivery but got %+v", msgReceive)
+	}
+
+	if time.Until(msgReceive.LockedUntilUtc) <= 0 {
+		t.Fatalf("Expected LockedUntilUtc in the future but got %s", msgReceive.LockedUntilUtc)
+	}
+
+	if err := cli.DeleteMessage(msgReceive); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.MessageCount("test") != 0 {
+		t.Fatalf("Expected empty queue but got %d messages", s.MessageCount("test"))
+	}
+}
+
+func TestServer_Unlock(t *testing.T) {
+
+	s := queuetest.NewServer("key", "keyvalue")
+	defer s.Close()
+
+	cli := newClient(s)
+
+	if err := cli.SendMessage(queue.NewMessage([]byte("Hello!"))); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := cli.GetMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.UnlockMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err = cli.GetMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.DeliveryCount != 2 {
+		t.Fatalf("Expected DeliveryCount 2 but got %d", msg.DeliveryCount)
+	}
+}
+
+func TestServer_LockExpiry(t *testing.T) {
+
+	s := queuetest.NewServer("key", "keyvalue")
+	s.LockDuration = time.Second
+	defer s.Close()
+
+	cli := newClient(s)
+	cli.Timeout = 3
+
+	if err := cli.SendMessage(queue.NewMessage([]byte("Hello!"))); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := cli.GetMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.RenewLock(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// the message becomes available again once its lock expires
+	second, err := cli.GetMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.DeliveryCount != 2 {
+		t.Fatalf("Expected DeliveryCount 2 but got %d", second.DeliveryCount)
+	}
+
+	if !first.LockExpired() {
+		t.Fatalf("Expected lock to be expired at %s", first.LockedUntilUtc)
+	}
+
+	err = cli.DeleteMessage(first)
+	if !errors.As(err, &queue.LockLostError{}) {
+		t.Fatalf("Expected LockLostError for expired lock but got %v", err)
+	}
+
+	if err := cli.DeleteMessage(second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServer_LockLost(t *testing.T) {
+
+	s := queuetest.NewServer("key", "keyvalue")
+	s.LockDuration = time.Second
+	defer s.Close()
+
+	cli := newClient(s)
+
+	if err := cli.SendMessage(queue.NewMessage([]byte("Hello!"))); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := cli.GetMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	// without LockedUntilUtc the expiry is only detected by the server
+	msg.LockedUntilUtc = time.Time{}
+
+	err = cli.DeleteMessage(msg)
+	if !errors.As(err, &queue.LockLostError{}) || !errors.As(err, &queue.MessageDontExistError{}) {
+		t.Fatalf("Expected LockLostError for expired lock but got %v", err)
+	}
+}
+
+func TestServer_ReceiveAndDelete(t *testing.T) {
+
+	s := queuetest.NewServer("key", "keyvalue")
+	defer s.Close()
+
+	cli := newClient(s)
+
+	if err := cli.SendBatch([]*queue.Message{queue.NewMessage([]byte("1")), queue.NewMessage([]byte("2"))}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"1", "2"} {
+		msg, err := cli.ReceiveAndDelete()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(msg.Body) != expected {
+			t.Fatalf("Expected body %s but got %s", expected, string(msg.Body))
+		}
+	}
+
+	if s.MessageCount("test") != 0 {
+		t.Fatalf("Expected empty queue but got %d messages", s.MessageCount("test"))
+	}
+}
+
+func TestServer_LongPoll(t *testing.T) {
+
+	s := queuetest.NewServer("key", "keyvalue")
+	defer s.Close()
+
+	cli := newClient(s)
+	cli.Timeout = 5
+
+	sender := newClient(s)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		sender.SendMessage(queue.NewMessage([]byte("Hello!")))
+	}()
+
+	start := time.Now()
+	if _, err := cli.ReceiveAndDelete(); err != nil {
+		t.Fatal(err)
+	}
+
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("Expected receive to return when the message is sent but took %s", time.Since(start))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := cli.GetMessageContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected error %v but got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestServer_errors(t *testing.T) {
+
+	s := queuetest.NewServer("key", "keyvalue")
+	defer s.Close()
+
+	cli := newClient(s)
+
+	tests := []struct {
+		cli *queue.QueueClient
+		err reflect.Type
+	}{
+		{&queue.QueueClient{Endpoint: s.URL, KeyName: "key", KeyValue: "keyvalue", QueueName: "test", Timeout: 0}, reflect.TypeOf(queue.NoMessagesAvailableError{})},
+		{&queue.QueueClient{Endpoint: s.URL, KeyName: "key", KeyValue: "wrong", QueueName: "test"}, reflect.TypeOf(queue.NotAuthorizedError{})},
+		{&queue.QueueClient{Endpoint: s.URL, KeyName: "wrong", KeyValue: "keyvalue", QueueName: "test"}, reflect.TypeOf(queue.NotAuthorizedError{})},
+		{&queue.QueueClient{Endpoint: s.URL, KeyName: "key", KeyValue: "keyvalue", QueueName: "missing"}, reflect.TypeOf(queue.QueueDontExistError{})},
+	}
+
+	for _, test := range tests {
+		if _, err := test.cli.GetMessage(); !errors.As(err, reflect.New(test.err).Interface()) {
+			t.Fatalf("Expected error type %s but got %v", test.err, err)
+		}
+	}
+
+	err := cli.DeleteMessage(&queue.Message{Id: "1", LockToken: "2"})
+	if !errors.As(err, &queue.MessageDontExistError{}) {
+		t.Fatalf("Expected MessageDontExistError but got %v", err)
+	}
+}
+
+func TestServer_Schedule(t *testing.T) {
+
+	s := queuetest.NewServer("key", "keyvalue")
+	defer s.Close()
+
+	cli := newClient(s)
+	cli.Timeout = 0
+
+	if err := cli.ScheduleMessage(queue.NewMessage([]byte("scheduled")), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cli.GetMessage(); err == nil {
+		t.Fatal("Expected scheduled messages not to be available yet")
+	}
+
+	cli.Timeout = 3
+
+	received, err := cli.ReceiveAndDelete()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(received.Body) != "scheduled" {
+		t.Fatalf("Expected body %s but got %s", "scheduled", string(received.Body))
+	}
+
+	if s.MessageCount("test") != 0 {
+		t.Fatalf("Expected empty queue but got %d messages", s.MessageCount("test"))
+	}
+}
+
+func TestServer_DeadLetter(t *testing.T) {
+
+	s := queuetest.NewServer("key", "keyvalue")
+	s.MaxDeliveryCount = 2
+	defer s.Close()
+
+	cli := newClient(s)
+	cli.Timeout = 0
+
+	if err := cli.SendMessage(queue.NewMessage([]byte("poison"))); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg *queue.Message
+	for i := 0; i < 2; i++ {
+		var err error
+		if msg, err = cli.GetMessage(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := cli.UnlockMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the message is dead-lettered instead of delivered a third time
+	if _, err := cli.GetMessage(); !errors.As(err, &queue.NoMessagesAvailableError{}) {
+		t.Fatalf("Expected NoMessagesAvailableError but got %v", err)
+	}
+
+	if s.MessageCount("test") != 0 {
+		t.Fatalf("Expected empty queue but got %d messages", s.MessageCount("test"))
+	}
+
+	dead, err := cli.DeadLetterQueue().GetMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(dead.Body) != "poison" || dead.Id != msg.Id {
+		t.Fatalf("Expected dead-lettered message %s but got %s", msg.Id, dead.Id)
+	}
+
+	if dead.DeadLetterReason != "MaxDeliveryCountExceeded" || dead.DeadLetterErrorDescription == "" {
+		t.Fatalf("Expected DeadLetterReason and DeadLetterErrorDescription but got %s and %s", dead.DeadLetterReason, dead.DeadLetterErrorDescription)
+	}
+
+	if dead.Properties.Get("DeadLetterReason") != "" {
+		t.Fatal("Expected DeadLetterReason not to be a custom property")
+	}
+
+	if err := cli.DeadLetterQueue().DeleteMessage(dead); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.MessageCount("test/$DeadLetterQueue") != 0 {
+		t.Fatalf("Expected empty dead-letter queue but got %d messages", s.MessageCount("test/$DeadLetterQueue"))
+	}
+}
+
+func TestServer_Management(t *testing.T) {
+
+	s := queuetest.NewServer("key", "keyvalue")
+	defer s.Close()
+
+	m := queue.NewManagementClient(newClient(s))
+	ctx := context.Background()
+
+	created, err := m.CreateQueue(ctx, &queue.QueueDescription{
+		Name:             "orders",
+		LockDuration:     time.Minute,
+		MaxDeliveryCount: 5,
+		RequiresSession:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created.Name != "orders" || created.LockDuration != time.Minute || !created.RequiresSession {
+		t.Fatalf("Expected created queue description but got %+v", created)
+	}
+
+	if _, err := m.CreateQueue(ctx, &queue.QueueDescription{Name: "orders"}); !errors.As(err, &queue.ConflictError{}) {
+		t.Fatalf("Expected %T creating an existing queue but got %v", queue.ConflictError{}, err)
+	}
+
+	created.MaxDeliveryCount = 10
+	if _, err := m.UpdateQueue(ctx, created); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := m.GetQueue(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, created) {
+		t.Fatalf("Expected %+v but got %+v", created, got)
+	}
+
+	queues, err := m.ListQueues(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queues) != 2 || queues[0].Name != "orders" || queues[1].Name != "test" {
+		t.Fatalf("Expected queues orders and test but got %d queues", len(queues))
+	}
+
+	if err := m.DeleteQueue(ctx, "orders"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.GetQueue(ctx, "orders"); !errors.As(err, &queue.QueueDontExistError{}) {
+		t.Fatalf("Expected %T but got %v", queue.QueueDontExistError{}, err)
+	}
+
+	if err := m.DeleteQueue(ctx, "orders"); !errors.As(err, &queue.QueueDontExistError{}) {
+		t.Fatalf("Expected %T but got %v", queue.QueueDontExistError{}, err)
+	}
+
+	if _, err := m.UpdateQueue(ctx, created); !errors.As(err, &queue.QueueDontExistError{}) {
+		t.Fatalf("Expected %T but got %v", queue.QueueDontExistError{}, err)
+	}
+}
+
+func TestServer_RuntimeInfo(t *testing.T) {
+
+	s := queuetest.NewServer("key", "keyvalue")
+	s.MaxDeliveryCount = 1
+	defer s.Close()
+
+	cli := newClient(s)
+
+	for _, body := range []string{"poison", "active"} {
+		if err := cli.SendMessage(queue.NewMessage([]byte(body))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cli.ScheduleMessage(queue.NewMessage([]byte("later")), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := cli.GetMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.UnlockMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// dead-letters the first message, which was delivered MaxDeliveryCount times
+	if _, err := cli.GetMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := cli.GetQueueRuntimeInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name != "test" || info.MessageCount != 3 || info.ActiveMessageCount != 1 ||
+		info.DeadLetterMessageCount != 1 || info.ScheduledMessageCount != 1 || info.SizeInBytes != 17 {
+		t.Fatalf("Unexpected runtime info %+v", info)
+	}
+
+	if info.CreatedAt.IsZero() || info.AccessedAt.Before(info.CreatedAt) {
+		t.Fatalf("Expected CreatedAt and AccessedAt to be set but got %v and %v", info.CreatedAt, info.AccessedAt)
+	}
+}
+
+func TestServer_TypedProperties(t *testing.T) {
+
+	s := queuetest.NewServer("key", "keyvalue")
+	defer s.Close()
+
+	cli := newClient(s)
+
+	single := queue.NewMessage([]byte("single"))
+	batched := queue.NewMessage([]byte("batched"))
+
+	for _, msg := range []*queue.Message{single, batched} {
+		msg.TypedProperties.SetInt64("Count", 42)
+		msg.TypedProperties.SetFloat64("Ratio", 2)
+		msg.TypedProperties.SetBool("Urgent", true)
+		msg.TypedProperties.SetTime("Due", time.Date(2018, 2, 21, 21, 3, 56, 0, time.UTC))
+		msg.TypedProperties.Set("Name", "42")
+	}
+
+	if err := cli.SendMessage(single); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.SendBatch([]*queue.Message{batched}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sent := range []*queue.Message{single, batched} {
+		received, err := cli.ReceiveAndDelete()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for k, v := range sent.TypedProperties {
+			if !reflect.DeepEqual(received.TypedProperties[k], v) {
+				t.Fatalf("Expected %s property %s value %#v but got %#v", sent.Body, k, v, received.TypedProperties[k])
+			}
+		}
+	}
+}
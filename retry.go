@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how transient failures of idempotent operations are retried.
+// Sends are only retried when the message has a MessageId, so that duplicate detection
+// can discard the copy of a failed attempt that reached the queue.
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one.
+	MaxAttempts int
+
+	// Delay before the first retry. It doubles after every attempt.
+	BaseDelay time.Duration
+
+	// Upper bound of the delay between attempts. Zero means no bound.
+	MaxDelay time.Duration
+
+	// Fraction of the delay that is randomized, between 0 and 1.
+	Jitter float64
+
+	// Reports whether a failed attempt should be retried. Defaults to IsRetryable.
+	Retryable func(err error) bool
+}
+
+// Returns a policy making up to 4 attempts with delays starting at 500ms.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// Reports whether err is a transient failure, see IsTransient.
+func IsRetryable(err error) bool {
+	return IsTransient(err)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p == nil {
+		return false
+	}
+
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	return IsRetryable(err)
+}
+
+// Returns the delay before the attempt following the given one.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		delay -= time.Duration(p.Jitter * rand.Float64() * float64(delay))
+	}
+
+	return delay
+}
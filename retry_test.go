@@ -0,0 +1,197 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Returns a client failing the first failures requests with status code.
+func failingClient(failures int, code int) (HttpClient, *int) {
+	attempts := 0
+	return httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts <= failures {
+			return &http.Response{StatusCode: code, Body: ioutil.NopCloser(bytes.NewBufferString("failed"))}, nil
+		}
+		return &http.Response{StatusCode: http.StatusCreated, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+	}), &attempts
+}
+
+var testRetryPolicy = &RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    5 * time.Millisecond,
+}
+
+func Test_RetryPolicy_retries(t *testing.T) {
+
+	client, attempts := failingClient(2, http.StatusInternalServerError)
+	SetHttpClient(client)
+	defer SetHttpClient(nil)
+
+	cli := QueueClient{Namespace: "test", QueueName: "test", RetryPolicy: testRetryPolicy}
+
+	if err := cli.DeleteMessage(&testMsg); err != nil {
+		t.Fatal(err)
+	}
+
+	if *attempts != 3 {
+		t.Fatalf("Expected 3 attempts but got %d", *attempts)
+	}
+}
+
+func Test_RetryPolicy_maxAttempts(t *testing.T) {
+
+	client, attempts := failingClient(5, http.StatusServiceUnavailable)
+	SetHttpClient(client)
+	defer SetHttpClient(nil)
+
+	cli := QueueClient{Namespace: "test", QueueName: "test", RetryPolicy: testRetryPolicy}
+
+	if err := cli.UnlockMessage(&testMsg); err == nil {
+		t.Fatal("Expected error but got nil")
+	}
+
+	if *attempts != 3 {
+		t.Fatalf("Expected 3 attempts but got %d", *attempts)
+	}
+}
+
+func Test_RetryPolicy_notRetryable(t *testing.T) {
+
+	client, attempts := failingClient(5, http.StatusBadRequest)
+	SetHttpClient(client)
+	defer SetHttpClient(nil)
+
+	cli := QueueClient{Namespace: "test", QueueName: "test", RetryPolicy: testRetryPolicy}
+
+	if err := cli.DeleteMessage(&testMsg); !errors.As(err, &BadRequestError{}) {
+		t.Fatalf("Expected %T but got %v", BadRequestError{}, err)
+	}
+
+	if *attempts != 1 {
+		t.Fatalf("Expected 1 attempt but got %d", *attempts)
+	}
+}
+
+func Test_RetryPolicy_send(t *testing.T) {
+
+	cli := QueueClient{Namespace: "test", QueueName: "test", RetryPolicy: testRetryPolicy}
+
+	client, attempts := failingClient(1, http.StatusInternalServerError)
+	SetHttpClient(client)
+	defer SetHttpClient(nil)
+
+	if err := cli.SendMessage(NewMessage([]byte("hello"))); err == nil {
+		t.Fatal("Expected send without MessageId not to be retried")
+	}
+
+	if *attempts != 1 {
+		t.Fatalf("Expected 1 attempt but got %d", *attempts)
+	}
+
+	client, attempts = failingClient(1, http.StatusInternalServerError)
+	SetHttpClient(client)
+
+	msg := NewMessage([]byte("hello"))
+	msg.Id = "1"
+
+	if err := cli.SendMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if *attempts != 2 {
+		t.Fatalf("Expected 2 attempts but got %d", *attempts)
+	}
+}
+
+func Test_RetryPolicy_transportError(t *testing.T) {
+
+	attempts := 0
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, &url.Error{Op: "Post", URL: req.URL.String(), Err: syscall.ECONNRESET}
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	cli := QueueClient{Namespace: "test", QueueName: "test", RetryPolicy: testRetryPolicy}
+
+	if _, err := cli.GetMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 2 {
+		t.Fatalf("Expected 2 attempts but got %d", attempts)
+	}
+}
+
+func Test_RetryPolicy_cancelled(t *testing.T) {
+
+	client, _ := failingClient(5, http.StatusInternalServerError)
+	SetHttpClient(client)
+	defer SetHttpClient(nil)
+
+	cli := QueueClient{Namespace: "test", QueueName: "test", RetryPolicy: &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := cli.DeleteMessageContext(ctx, &testMsg); err != context.DeadlineExceeded {
+		t.Fatalf("Expected error %v but got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func Test_RetryPolicy_delay(t *testing.T) {
+
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	expected := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, e := range expected {
+		if d := p.delay(i + 1); d != e*time.Millisecond {
+			t.Fatalf("Expected delay %s for attempt %d but got %s", e*time.Millisecond, i+1, d)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.delay(1); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("Expected delay between 50ms and 100ms but got %s", d)
+		}
+	}
+}
+
+func Test_IsRetryable(t *testing.T) {
+
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{InternalError{500, ""}, true},
+		{ThrottledError{429, ""}, true},
+		{&ServiceBusError{Err: ServerBusyError{503, ""}}, true},
+		{unknownStatusError{501, ""}, false},
+		{BadRequestError{400, ""}, false},
+		{NoMessagesAvailableError{204, ""}, false},
+		{io.ErrUnexpectedEOF, true},
+		{&url.Error{Op: "Post", Err: syscall.ECONNRESET}, true},
+		{fmt.Errorf("other"), false},
+	}
+
+	for _, test := range tests {
+		if IsRetryable(test.err) != test.retryable {
+			t.Fatalf("Expected IsRetryable(%v) to be %v", test.err, test.retryable)
+		}
+	}
+}
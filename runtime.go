@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"time"
+)
+
+// Message counts, size and timestamps of a queue, e.g. to alert on its depth.
+type QueueRuntimeInfo struct {
+	// Name of the queue, its path relative to the namespace.
+	Name string
+
+	// Number of messages in the queue, including dead-lettered and scheduled messages.
+	MessageCount int64
+
+	// Number of messages available for receiving, locked or not.
+	ActiveMessageCount int64
+
+	// Number of messages in the dead-letter queue.
+	DeadLetterMessageCount int64
+
+	// Number of messages scheduled for a later enqueue time.
+	ScheduledMessageCount int64
+
+	// Number of messages pending transfer to another queue or topic.
+	TransferMessageCount int64
+
+	// Number of messages that failed to transfer and were dead-lettered.
+	TransferDeadLetterMessageCount int64
+
+	// Size of the queue in bytes.
+	SizeInBytes int64
+
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	AccessedAt time.Time
+}
+
+// Returns the runtime metrics of the queue of the client, see ManagementClient.GetQueueRuntimeInfo.
+func (q *QueueClient) GetQueueRuntimeInfo() (*QueueRuntimeInfo, error) {
+	return q.GetQueueRuntimeInfoContext(context.Background())
+}
+
+// GetQueueRuntimeInfoContext is like GetQueueRuntimeInfo but uses ctx to cancel the request or limit its duration.
+func (q *QueueClient) GetQueueRuntimeInfoContext(ctx context.Context) (*QueueRuntimeInfo, error) {
+	return NewManagementClient(q).GetQueueRuntimeInfo(ctx, q.entity())
+}
+
+// Returns the message counts, size and timestamps of a queue from its entity description.
+// A QueueDontExistError is returned if the queue doesn't exist.
+// Requests must be authorized with a policy with the Manage right.
+func (m *ManagementClient) GetQueueRuntimeInfo(ctx context.Context, name string) (*QueueRuntimeInfo, error) {
+	resp, err := m.q.do(ctx, "GetQueueRuntimeInfo", true, func() (*http.Request, error) {
+		return m.createRequest(ctx, name, "GET", nil)
+	})
+
+	if err != nil {
+		return nil, queueError(err)
+	}
+
+	defer resp.Body.Close()
+
+	entry := queueRuntimeEntry{}
+	if err := readEntry(resp.Body, &entry); err != nil {
+		return nil, err
+	}
+
+	x := entry.Content.QueueDescription
+	if x == nil {
+		return nil, QueueDontExistError{Code: http.StatusNotFound}
+	}
+
+	return &QueueRuntimeInfo{
+		Name:                           entry.Title,
+		MessageCount:                   x.MessageCount,
+		ActiveMessageCount:             x.CountDetails.ActiveMessageCount,
+		DeadLetterMessageCount:         x.CountDetails.DeadLetterMessageCount,
+		ScheduledMessageCount:          x.CountDetails.ScheduledMessageCount,
+		TransferMessageCount:           x.CountDetails.TransferMessageCount,
+		TransferDeadLetterMessageCount: x.CountDetails.TransferDeadLetterMessageCount,
+		SizeInBytes:                    x.SizeInBytes,
+		CreatedAt:                      x.CreatedAt,
+		UpdatedAt:                      x.UpdatedAt,
+		AccessedAt:                     x.AccessedAt,
+	}, nil
+}
+
+type queueRuntimeEntry struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom entry"`
+	Title   string   `xml:"title"`
+	Content struct {
+		QueueDescription *queueRuntimeXML `xml:"http://schemas.microsoft.com/netservices/2010/10/servicebus/connect QueueDescription"`
+	} `xml:"content"`
+}
+
+// Runtime elements of a QueueDescription, counts are in the servicebus 2011/06 namespace.
+type queueRuntimeXML struct {
+	SizeInBytes  int64     `xml:"SizeInBytes"`
+	MessageCount int64     `xml:"MessageCount"`
+	CreatedAt    time.Time `xml:"CreatedAt"`
+	UpdatedAt    time.Time `xml:"UpdatedAt"`
+	AccessedAt   time.Time `xml:"AccessedAt"`
+	CountDetails struct {
+		ActiveMessageCount             int64 `xml:"ActiveMessageCount"`
+		DeadLetterMessageCount         int64 `xml:"DeadLetterMessageCount"`
+		ScheduledMessageCount          int64 `xml:"ScheduledMessageCount"`
+		TransferMessageCount           int64 `xml:"TransferMessageCount"`
+		TransferDeadLetterMessageCount int64 `xml:"TransferDeadLetterMessageCount"`
+	} `xml:"CountDetails"`
+}
@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_GetQueueRuntimeInfo(t *testing.T) {
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != "GET" || req.URL.Path != "/test" {
+			t.Fatalf("Unexpected request %s %s", req.Method, req.URL.Path)
+		}
+
+		entry := `<entry xmlns="http://www.w3.org/2005/Atom">
+	<title type="text">test</title>
+	<content type="application/xml">
+		<QueueDescription xmlns="http://schemas.microsoft.com/netservices/2010/10/servicebus/connect" xmlns:i="http://www.w3.org/2001/XMLSchema-instance">
+			<LockDuration>PT1M</LockDuration>
+			<SizeInBytes>2048</SizeInBytes>
+			<MessageCount>10</MessageCount>
+			<CreatedAt>2018-02-21T21:03:56.0933333Z</CreatedAt>
+			<UpdatedAt>2018-02-22T09:00:00Z</UpdatedAt>
+			<AccessedAt>2018-02-23T10:30:00.5Z</AccessedAt>
+			<CountDetails xmlns:d2p1="http://schemas.microsoft.com/netservices/2011/06/servicebus">
+				<d2p1:ActiveMessageCount>5</d2p1:ActiveMessageCount>
+				<d2p1:DeadLetterMessageCount>2</d2p1:DeadLetterMessageCount>
+				<d2p1:ScheduledMessageCount>1</d2p1:ScheduledMessageCount>
+				<d2p1:TransferMessageCount>1</d2p1:TransferMessageCount>
+				<d2p1:TransferDeadLetterMessageCount>1</d2p1:TransferDeadLetterMessageCount>
+			</CountDetails>
+		</QueueDescription>
+	</content>
+</entry>`
+
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString(entry))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	info, err := q.GetQueueRuntimeInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := QueueRuntimeInfo{
+		Name:                           "test",
+		MessageCount:                   10,
+		ActiveMessageCount:             5,
+		DeadLetterMessageCount:         2,
+		ScheduledMessageCount:          1,
+		TransferMessageCount:           1,
+		TransferDeadLetterMessageCount: 1,
+		SizeInBytes:                    2048,
+		CreatedAt:                      time.Date(2018, 2, 21, 21, 3, 56, 93333300, time.UTC),
+		UpdatedAt:                      time.Date(2018, 2, 22, 9, 0, 0, 0, time.UTC),
+		AccessedAt:                     time.Date(2018, 2, 23, 10, 30, 0, 500000000, time.UTC),
+	}
+
+	if !reflect.DeepEqual(*info, expected) {
+		t.Fatalf("Expected %+v but got %+v", expected, *info)
+	}
+}
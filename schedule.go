@@ -0,0 +1,36 @@
+package queue
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Sends a message that becomes available to receivers at the given time.
+// msg.ScheduledEnqueueTimeUtc is updated accordingly.
+//
+// The REST API doesn't report the sequence number of the scheduled message,
+// so cancelling it before it's enqueued requires AMQP.
+//
+// For more information see https://docs.microsoft.com/en-us/rest/api/servicebus/message-headers-and-properties
+func (q *QueueClient) ScheduleMessage(msg *Message, at time.Time) error {
+	return q.ScheduleMessageContext(context.Background(), msg, at)
+}
+
+// ScheduleMessageContext is like ScheduleMessage but uses ctx for the request.
+// If ctx is done before the message is scheduled, ctx.Err() is returned.
+func (q *QueueClient) ScheduleMessageContext(ctx context.Context, msg *Message, at time.Time) error {
+
+	msg.ScheduledEnqueueTimeUtc = at.UTC()
+
+	// without a MessageId duplicate detection can't discard the message of a failed attempt
+	resp, err := q.do(ctx, "ScheduleMessage", msg.Id != "", func() (*http.Request, error) {
+		return q.createRequestFromMessage(ctx, "messages/", "POST", msg)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
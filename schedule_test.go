@@ -0,0 +1,40 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_ScheduleMessage(t *testing.T) {
+
+	at := time.Date(2018, 2, 22, 10, 3, 56, 0, time.FixedZone("NZDT", 13*60*60))
+
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		p := brokerProperties{}
+		if err := json.Unmarshal([]byte(req.Header.Get(headerBrokerProperties)), &p); err != nil {
+			t.Fatal(err)
+		}
+
+		if p.ScheduledEnqueueTimeUtc != "Wed, 21 Feb 2018 21:03:56 GMT" {
+			t.Fatalf("Expected ScheduledEnqueueTimeUtc %s but got %s", "Wed, 21 Feb 2018 21:03:56 GMT", p.ScheduledEnqueueTimeUtc)
+		}
+
+		// the service answers without BrokerProperties
+		return &http.Response{StatusCode: http.StatusCreated, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	msg := NewMessage([]byte("hello"))
+
+	if err := q.ScheduleMessage(msg, at); err != nil {
+		t.Fatal(err)
+	}
+
+	if !msg.ScheduledEnqueueTimeUtc.Equal(at) {
+		t.Fatalf("Expected ScheduledEnqueueTimeUtc %s but got %s", at, msg.ScheduledEnqueueTimeUtc)
+	}
+}
@@ -0,0 +1,199 @@
+package queue
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token authorizes requests to Service Bus.
+type Token struct {
+	// Value of the Authorization header, e.g. "SharedAccessSignature sig=..." or "Bearer ...".
+	Value string
+
+	// Time the token expires. Zero if the token doesn't expire or the expiry is unknown.
+	Expiry time.Time
+}
+
+// TokenProvider supplies tokens authorizing requests to the entity at audience,
+// e.g. https://<yournamespace>.servicebus.windows.net:443/<queue>/.
+// It must be safe for concurrent use.
+type TokenProvider interface {
+	Token(ctx context.Context, audience string) (Token, error)
+}
+
+// TokenProviderFunc adapts a function, e.g. one fetching Azure AD bearer tokens from a credential service, to a TokenProvider.
+type TokenProviderFunc func(ctx context.Context, audience string) (Token, error)
+
+func (f TokenProviderFunc) Token(ctx context.Context, audience string) (Token, error) {
+	return f(ctx, audience)
+}
+
+// Default lifetime of tokens signed by SharedAccessKeyProvider.
+const defaultSharedAccessSignatureExpiry = 300 * time.Second
+
+// SharedAccessKeyProvider signs a new Shared Access Signature token for every request.
+//
+// For more information see: https://docs.microsoft.com/en-us/azure/service-bus-messaging/service-bus-sas
+type SharedAccessKeyProvider struct {
+	// Policy name e.g. RootManageSharedAccessKey
+	KeyName string
+
+	// Policy value.
+	KeyValue string
+
+	// Lifetime of the signed tokens. Defaults to 5 minutes.
+	Expiry time.Duration
+}
+
+func (p *SharedAccessKeyProvider) Token(ctx context.Context, audience string) (Token, error) {
+	return p.sign(audience, time.Now()), nil
+}
+
+// Creates a Shared Access Signature token for uri valid from the given time.
+func (p *SharedAccessKeyProvider) sign(uri string, from time.Time) Token {
+
+	expireIn := p.Expiry
+	if expireIn <= 0 {
+		expireIn = defaultSharedAccessSignatureExpiry
+	}
+
+	expiresAt := from.Add(expireIn).Round(time.Second)
+	expiry := strconv.Itoa(int(expiresAt.Unix()))
+
+	// as per https://docs.microsoft.com/en-us/azure/service-bus-messaging/service-bus-sas
+	encodedUri := strings.ToLower(url.QueryEscape(uri))
+	sig := p.signature(encodedUri + "\n" + expiry)
+
+	return Token{
+		Value:  fmt.Sprintf("SharedAccessSignature sig=%s&se=%s&skn=%s&sr=%s", sig, expiry, p.KeyName, encodedUri),
+		Expiry: expiresAt,
+	}
+}
+
+// Returns SHA-256 hash of the scope of the token with a CRLF appended and an expiry time.
+func (p *SharedAccessKeyProvider) signature(s string) string {
+	// as per https://docs.microsoft.com/en-us/azure/service-bus-messaging/service-bus-sas
+	h := hmac.New(sha256.New, []byte(p.KeyValue))
+	h.Write([]byte(s))
+	encodedSig := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return url.QueryEscape(encodedSig)
+}
+
+// Creates a provider returning a pre-issued Shared Access Signature token
+// of the form SharedAccessSignature sr=<resource>&sig=<signature>&se=<expiry>[&skn=<policy>].
+func NewSharedAccessSignatureProvider(sas string) (TokenProvider, error) {
+
+	token, err := parseSharedAccessSignature(sas)
+	if err != nil {
+		return nil, err
+	}
+
+	return TokenProviderFunc(func(ctx context.Context, audience string) (Token, error) {
+		return token, nil
+	}), nil
+}
+
+func parseSharedAccessSignature(sas string) (Token, error) {
+
+	const prefix = "SharedAccessSignature "
+
+	if !strings.HasPrefix(sas, prefix) {
+		return Token{}, fmt.Errorf("Expected %s prefix", strings.TrimSpace(prefix))
+	}
+
+	fields, err := url.ParseQuery(strings.TrimPrefix(sas, prefix))
+	if err != nil {
+		return Token{}, err
+	}
+
+	for _, field := range []string{"sr", "sig", "se"} {
+		if fields.Get(field) == "" {
+			return Token{}, fmt.Errorf("Missing %s field", field)
+		}
+	}
+
+	expiry, err := strconv.ParseInt(fields.Get("se"), 10, 64)
+	if err != nil {
+		return Token{}, fmt.Errorf("Malformed se field: %s", fields.Get("se"))
+	}
+
+	return Token{Value: sas, Expiry: time.Unix(expiry, 0)}, nil
+}
+
+// Creates a provider that reuses the tokens of p per audience until refreshBefore their expiry.
+// Tokens without an expiry are reused indefinitely.
+// Concurrent callers share a single fetch per audience, fetches of other audiences don't wait for it.
+func NewCachedTokenProvider(p TokenProvider, refreshBefore time.Duration) TokenProvider {
+	return &cachedTokenProvider{
+		provider:      p,
+		refreshBefore: refreshBefore,
+		tokens:        map[string]Token{},
+		fetches:       map[string]*tokenFetch{},
+	}
+}
+
+type cachedTokenProvider struct {
+	provider      TokenProvider
+	refreshBefore time.Duration
+
+	mu      sync.Mutex
+	tokens  map[string]Token
+	fetches map[string]*tokenFetch
+}
+
+// Fetch of a token in progress, done is closed once token or err is set.
+type tokenFetch struct {
+	done  chan struct{}
+	token Token
+	err   error
+}
+
+func (c *cachedTokenProvider) Token(ctx context.Context, audience string) (Token, error) {
+	c.mu.Lock()
+
+	if token, ok := c.tokens[audience]; ok {
+		if token.Expiry.IsZero() || time.Now().Add(c.refreshBefore).Before(token.Expiry) {
+			c.mu.Unlock()
+			return token, nil
+		}
+	}
+
+	f, ok := c.fetches[audience]
+	if !ok {
+		f = &tokenFetch{done: make(chan struct{})}
+		c.fetches[audience] = f
+
+		// other callers may wait for the fetch, so it isn't cancelled with ctx
+		go c.fetch(context.WithoutCancel(ctx), audience, f)
+	}
+
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return Token{}, ctx.Err()
+	case <-f.done:
+		return f.token, f.err
+	}
+}
+
+func (c *cachedTokenProvider) fetch(ctx context.Context, audience string, f *tokenFetch) {
+	f.token, f.err = c.provider.Token(ctx, audience)
+
+	c.mu.Lock()
+	if f.err == nil {
+		c.tokens[audience] = f.token
+	}
+	delete(c.fetches, audience)
+	c.mu.Unlock()
+
+	close(f.done)
+}
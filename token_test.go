@@ -0,0 +1,182 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_SharedAccessKeyProvider(t *testing.T) {
+
+	p := SharedAccessKeyProvider{KeyName: "key", KeyValue: "keyvalue"}
+	from := time.Date(2018, 1, 1, 1, 1, 1, 0, loc)
+
+	token := p.sign("https://test.servicebus.windows.net:443/test/", from)
+
+	if token.Value != q.makeAuthHeader("https://test.servicebus.windows.net:443/test/", from) {
+		t.Fatalf("Expected token %s but got %s", q.makeAuthHeader("https://test.servicebus.windows.net:443/test/", from), token.Value)
+	}
+
+	if !token.Expiry.Equal(from.Add(300 * time.Second)) {
+		t.Fatalf("Expected expiry %s but got %s", from.Add(300*time.Second), token.Expiry)
+	}
+
+	p.Expiry = time.Hour
+	if token := p.sign("https://test.servicebus.windows.net:443/test/", from); !token.Expiry.Equal(from.Add(time.Hour)) {
+		t.Fatalf("Expected expiry %s but got %s", from.Add(time.Hour), token.Expiry)
+	}
+}
+
+func Test_NewSharedAccessSignatureProvider(t *testing.T) {
+
+	sas := "SharedAccessSignature sr=https%3a%2f%2ftest.servicebus.windows.net%2ftest&sig=abc%3D&se=1514768761&skn=send"
+
+	p, err := NewSharedAccessSignatureProvider(sas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := p.Token(context.Background(), "https://test.servicebus.windows.net:443/test/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.Value != sas {
+		t.Fatalf("Expected token %s but got %s", sas, token.Value)
+	}
+
+	if token.Expiry.Unix() != 1514768761 {
+		t.Fatalf("Expected expiry %d but got %d", 1514768761, token.Expiry.Unix())
+	}
+
+	for _, invalid := range []string{"sr=a&sig=b&se=1", "SharedAccessSignature sr=a&sig=b", "SharedAccessSignature sr=a&sig=b&se=x"} {
+		if _, err := NewSharedAccessSignatureProvider(invalid); err == nil {
+			t.Fatalf("Expected error for token %s but got nil", invalid)
+		}
+	}
+}
+
+func Test_CachedTokenProvider(t *testing.T) {
+
+	calls := 0
+	expiry := time.Now().Add(time.Hour)
+
+	p := NewCachedTokenProvider(TokenProviderFunc(func(ctx context.Context, audience string) (Token, error) {
+		calls++
+		return Token{Value: fmt.Sprintf("Bearer %s %d", audience, calls), Expiry: expiry}, nil
+	}), time.Minute)
+
+	for i := 0; i < 3; i++ {
+		token, _ := p.Token(context.Background(), "a")
+		if token.Value != "Bearer a 1" {
+			t.Fatalf("Expected cached token %s but got %s", "Bearer a 1", token.Value)
+		}
+	}
+
+	if token, _ := p.Token(context.Background(), "b"); token.Value != "Bearer b 2" {
+		t.Fatalf("Expected token %s but got %s", "Bearer b 2", token.Value)
+	}
+
+	// the cached token is about to expire
+	expiry = time.Now().Add(30 * time.Second)
+	p.Token(context.Background(), "c")
+
+	if token, _ := p.Token(context.Background(), "c"); token.Value != "Bearer c 4" {
+		t.Fatalf("Expected refreshed token %s but got %s", "Bearer c 4", token.Value)
+	}
+}
+
+func Test_TokenProvider(t *testing.T) {
+
+	cli := QueueClient{
+		Namespace: "test",
+		QueueName: "test",
+		TokenProvider: TokenProviderFunc(func(ctx context.Context, audience string) (Token, error) {
+			if audience != "https://test.servicebus.windows.net:443/test/" {
+				return Token{}, fmt.Errorf("unexpected audience %s", audience)
+			}
+			return Token{Value: "Bearer token"}, nil
+		}),
+	}
+
+	req, err := cli.createRequest(context.Background(), "messages/head", "POST")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Header.Get("Authorization") != "Bearer token" {
+		t.Fatalf("Expected Authorization %s but got %s", "Bearer token", req.Header.Get("Authorization"))
+	}
+
+	cli.QueueName = "other"
+	if _, err := cli.createRequest(context.Background(), "messages/head", "POST"); err == nil {
+		t.Fatal("Expected token error but got nil")
+	}
+}
+
+func Test_TokenProvider_cancelled(t *testing.T) {
+
+	cli := QueueClient{
+		Namespace: "test",
+		QueueName: "test",
+		TokenProvider: NewCachedTokenProvider(TokenProviderFunc(func(ctx context.Context, audience string) (Token, error) {
+			return Token{}, fmt.Errorf("token service unavailable")
+		}), time.Minute),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := cli.GetMessageContext(ctx); err != context.Canceled {
+		t.Fatalf("Expected error %v but got %v", context.Canceled, err)
+	}
+}
+
+func Test_CachedTokenProvider_slowFetch(t *testing.T) {
+
+	var calls int32
+	release := make(chan struct{})
+
+	p := NewCachedTokenProvider(TokenProviderFunc(func(ctx context.Context, audience string) (Token, error) {
+		atomic.AddInt32(&calls, 1)
+		if audience == "slow" {
+			<-release
+		}
+		return Token{Value: "Bearer " + audience}, nil
+	}), time.Minute)
+
+	// a caller gives up on the slow fetch with its own context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := p.Token(ctx, "slow"); err != context.DeadlineExceeded {
+		t.Fatalf("Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+
+	// other audiences don't wait for the slow fetch
+	if token, err := p.Token(context.Background(), "fast"); err != nil || token.Value != "Bearer fast" {
+		t.Fatalf("Expected token %s but got %s, %v", "Bearer fast", token.Value, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := p.Token(context.Background(), "slow"); err != nil || token.Value != "Bearer slow" {
+				t.Errorf("Expected token %s but got %s, %v", "Bearer slow", token.Value, err)
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("Expected one fetch per audience but got %d", n)
+	}
+}
@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Thread-safe client for sending messages to an Azure Service Bus Topic.
+type TopicClient struct {
+	// Name of the topic.
+	TopicName string
+
+	q *QueueClient
+}
+
+// Creates a client for the topic using the namespace, credentials and settings of c.
+// c.QueueName is ignored.
+func NewTopicClient(c *QueueClient, topicName string) *TopicClient {
+	return &TopicClient{
+		TopicName: topicName,
+		q:         c.withEntity(topicName),
+	}
+}
+
+// Sends message to a Service Bus topic.
+func (t *TopicClient) SendMessage(msg *Message) error {
+	return t.q.SendMessage(msg)
+}
+
+// SendMessageContext is like SendMessage but uses ctx for the request.
+func (t *TopicClient) SendMessageContext(ctx context.Context, msg *Message) error {
+	return t.q.SendMessageContext(ctx, msg)
+}
+
+// Sends messages to a Service Bus topic, see QueueClient.SendBatch.
+func (t *TopicClient) SendBatch(msgs []*Message) error {
+	return t.q.SendBatch(msgs)
+}
+
+// SendBatchContext is like SendBatch but uses ctx for the requests.
+func (t *TopicClient) SendBatchContext(ctx context.Context, msgs []*Message) error {
+	return t.q.SendBatchContext(ctx, msgs)
+}
+
+// Schedules a message on the topic, see QueueClient.ScheduleMessage.
+func (t *TopicClient) ScheduleMessage(msg *Message, at time.Time) error {
+	return t.q.ScheduleMessage(msg, at)
+}
+
+// ScheduleMessageContext is like ScheduleMessage but uses ctx for the request.
+func (t *TopicClient) ScheduleMessageContext(ctx context.Context, msg *Message, at time.Time) error {
+	return t.q.ScheduleMessageContext(ctx, msg, at)
+}
+
+// Thread-safe client for receiving messages from an Azure Service Bus Topic Subscription.
+type SubscriptionClient struct {
+	// Name of the topic.
+	TopicName string
+
+	// Name of the subscription.
+	SubscriptionName string
+
+	q *QueueClient
+}
+
+// Creates a client for the topic subscription using the namespace, credentials and settings of c.
+// c.QueueName is ignored.
+func NewSubscriptionClient(c *QueueClient, topicName string, subscriptionName string) *SubscriptionClient {
+	return &SubscriptionClient{
+		TopicName:        topicName,
+		SubscriptionName: subscriptionName,
+		q:                c.withEntity(topicName + "/subscriptions/" + subscriptionName),
+	}
+}
+
+// Retrieves and locks a message from the subscription, see QueueClient.GetMessage.
+func (s *SubscriptionClient) GetMessage() (*Message, error) {
+	return s.q.GetMessage()
+}
+
+// GetMessageContext is like GetMessage but uses ctx to cancel the long-poll or limit its duration.
+func (s *SubscriptionClient) GetMessageContext(ctx context.Context) (*Message, error) {
+	return s.q.GetMessageContext(ctx)
+}
+
+// Receives and deletes a message from the subscription, see QueueClient.ReceiveAndDelete.
+func (s *SubscriptionClient) ReceiveAndDelete() (*Message, error) {
+	return s.q.ReceiveAndDelete()
+}
+
+// ReceiveAndDeleteContext is like ReceiveAndDelete but uses ctx to cancel the long-poll or limit its duration.
+func (s *SubscriptionClient) ReceiveAndDeleteContext(ctx context.Context) (*Message, error) {
+	return s.q.ReceiveAndDeleteContext(ctx)
+}
+
+// Unlocks a message for processing by other receivers on the subscription, see QueueClient.UnlockMessage.
+func (s *SubscriptionClient) UnlockMessage(msg *Message) error {
+	return s.q.UnlockMessage(msg)
+}
+
+// UnlockMessageContext is like UnlockMessage but uses ctx for the request.
+func (s *SubscriptionClient) UnlockMessageContext(ctx context.Context, msg *Message) error {
+	return s.q.UnlockMessageContext(ctx, msg)
+}
+
+// Completes the processing of a locked message and deletes it from the subscription, see QueueClient.DeleteMessage.
+func (s *SubscriptionClient) DeleteMessage(msg *Message) error {
+	return s.q.DeleteMessage(msg)
+}
+
+// DeleteMessageContext is like DeleteMessage but uses ctx for the request.
+func (s *SubscriptionClient) DeleteMessageContext(ctx context.Context, msg *Message) error {
+	return s.q.DeleteMessageContext(ctx, msg)
+}
+
+// Extends the lock of a message, see QueueClient.RenewLock.
+func (s *SubscriptionClient) RenewLock(msg *Message) error {
+	return s.q.RenewLock(msg)
+}
+
+// RenewLockContext is like RenewLock but uses ctx for the request.
+func (s *SubscriptionClient) RenewLockContext(ctx context.Context, msg *Message) error {
+	return s.q.RenewLockContext(ctx, msg)
+}
+
+// Returns a client receiving from the dead-letter sub-queue of the subscription.
+func (s *SubscriptionClient) DeadLetterQueue() *SubscriptionClient {
+	return &SubscriptionClient{
+		TopicName:        s.TopicName,
+		SubscriptionName: s.SubscriptionName,
+		q:                s.q.DeadLetterQueue(),
+	}
+}
+
+// Keeps msg locked in the background, see QueueClient.AutoRenewLock.
+func (s *SubscriptionClient) AutoRenewLock(ctx context.Context, msg *Message, maxDuration time.Duration) (stop func()) {
+	return s.q.AutoRenewLock(ctx, msg, maxDuration)
+}
+
+func (s *SubscriptionClient) log() internalLogger {
+	return s.q.log()
+}
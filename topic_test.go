@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func Test_TopicClient(t *testing.T) {
+
+	var paths []string
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.Method+" "+req.URL.Path)
+		return &http.Response{StatusCode: http.StatusCreated, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	topic := NewTopicClient(&q, "my-topic")
+
+	if err := topic.SendMessage(NewMessage([]byte("hello"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := topic.SendBatch([]*Message{NewMessage([]byte("hello"))}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"POST /my-topic/messages/", "POST /my-topic/messages/"}
+	comparePaths(t, expected, paths)
+}
+
+func Test_SubscriptionClient(t *testing.T) {
+
+	var paths []string
+	SetHttpClient(httpClientFunc(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.Method+" "+req.URL.Path)
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewBufferString(""))}, nil
+	}))
+	defer SetHttpClient(nil)
+
+	sub := NewSubscriptionClient(&q, "my-topic", "my-sub")
+
+	if _, err := sub.GetMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sub.ReceiveAndDelete(); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &Message{Id: "1", LockToken: "token"}
+
+	if err := sub.RenewLock(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sub.UnlockMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sub.DeleteMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"POST /my-topic/subscriptions/my-sub/messages/head",
+		"DELETE /my-topic/subscriptions/my-sub/messages/head",
+		"POST /my-topic/subscriptions/my-sub/messages/1/token",
+		"PUT /my-topic/subscriptions/my-sub/messages/1/token",
+		"DELETE /my-topic/subscriptions/my-sub/messages/1/token",
+	}
+	comparePaths(t, expected, paths)
+}
+
+func comparePaths(t *testing.T, expected []string, actual []string) {
+	if len(actual) != len(expected) {
+		t.Fatalf("Expected requests %v but got %v", expected, actual)
+	}
+
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("Expected request %s but got %s", expected[i], actual[i])
+		}
+	}
+}